@@ -0,0 +1,106 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrNoSession is returned by the ambient functions when the context holds neither a session
+// installed with `WithSession()` nor a transaction.
+var ErrNoSession = errors.New("txctx: no session in context, see WithSession")
+
+type sessionKey struct{}
+
+// WithSession returns a copy of the context carrying the root session, typically installed by
+// a middleware, so that business code can query the database with the context alone through
+// `Exec()`, `Query()`, `QueryRow()`, `QueryPerformer()` and `InTransaction()`.
+func WithSession(ctx context.Context, s Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// QueryPerformer returns the performer of the transaction in the context, or of the session
+// installed with `WithSession()` if there is none. `ErrNoSession` is returned if the context
+// holds neither.
+func QueryPerformer(ctx context.Context) (Performer, error) {
+	if s, ok := ctx.Value(sessionKey{}).(Session); ok {
+		return s.QueryPerformer(ctx), nil
+	}
+	if t, _ := ctx.Value(transactionKey{}).(*transaction); t != nil {
+		return t.performer(), nil
+	}
+	if tx, ok := FromContext(ctx); ok {
+		return tx, nil
+	}
+	return nil, ErrNoSession
+}
+
+// Exec executes the query with the performer of the context, see `QueryPerformer()`.
+func Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	p, err := QueryPerformer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.ExecContext(ctx, query, args...)
+}
+
+// Query runs the query with the performer of the context, see `QueryPerformer()`.
+func Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	p, err := QueryPerformer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.QueryContext(ctx, query, args...)
+}
+
+// Row is the result of a query returning at most one row, like *sql.Row.
+type Row struct {
+	row *sql.Row
+	err error
+	// mapErr, if set, translates the errors of the row.
+	mapErr func(error) error
+}
+
+// QueryRow runs the query with the performer of the context, see `QueryPerformer()`.
+// If the context holds no session, `Row.Scan()` returns `ErrNoSession`.
+func QueryRow(ctx context.Context, query string, args ...any) *Row {
+	p, err := QueryPerformer(ctx)
+	if err != nil {
+		return &Row{err: err}
+	}
+	return &Row{row: p.QueryRowContext(ctx, query, args...)}
+}
+
+// Scan copies the columns of the row into dest, like `sql.Row.Scan()`.
+func (r *Row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	err := r.row.Scan(dest...)
+	if r.mapErr != nil {
+		err = r.mapErr(err)
+	}
+	return err
+}
+
+// Err returns the error of the query, if any, like `sql.Row.Err()`.
+func (r *Row) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	err := r.row.Err()
+	if r.mapErr != nil {
+		err = r.mapErr(err)
+	}
+	return err
+}
+
+// InTransaction executes a transaction with the session installed with `WithSession()`,
+// see `Session.Transaction()`. `ErrNoSession` is returned if the context holds no session.
+func InTransaction(ctx context.Context, f func(ctx context.Context) error) error {
+	s, ok := ctx.Value(sessionKey{}).(Session)
+	if !ok {
+		return ErrNoSession
+	}
+	return s.Transaction(ctx, f)
+}
@@ -0,0 +1,96 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmbient(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := WithSession(context.Background(), SQL(db, nil))
+
+	mock.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WithArgs("john", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT name FROM users").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("john"))
+	mock.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit()
+
+	// Outside of a transaction, the statements run on the database
+	_, err = Exec(ctx, "INSERT INTO audit (action) VALUES ('login')")
+	require.NoError(t, err)
+
+	err = InTransaction(ctx, func(ctx context.Context) error {
+		p, err := QueryPerformer(ctx)
+		require.NoError(t, err)
+		assert.IsType(t, &sql.Tx{}, p)
+
+		if _, err := Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "john", 1); err != nil {
+			return err
+		}
+		var name string
+		if err := QueryRow(ctx, "SELECT name FROM users WHERE id = ?", 1).Scan(&name); err != nil {
+			return err
+		}
+		assert.Equal(t, "john", name)
+
+		rows, err := Query(ctx, "SELECT id FROM users")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		assert.Equal(t, 2, n)
+		return rows.Err()
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAmbient_TransactionWithoutSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// The transaction in the context is enough to run statements, but not to start transactions
+	err = SQL(db, nil).Transaction(context.Background(), func(ctx context.Context) error {
+		assert.ErrorIs(t, InTransaction(ctx, func(ctx context.Context) error { return nil }), ErrNoSession)
+		_, err := Exec(ctx, "UPDATE users SET name = 'john'")
+		return err
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAmbient_NoSession(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := QueryPerformer(ctx)
+	assert.ErrorIs(t, err, ErrNoSession)
+	_, err = Exec(ctx, "DELETE FROM users")
+	assert.ErrorIs(t, err, ErrNoSession)
+	_, err = Query(ctx, "SELECT id FROM users")
+	assert.ErrorIs(t, err, ErrNoSession)
+
+	row := QueryRow(ctx, "SELECT id FROM users")
+	assert.ErrorIs(t, row.Err(), ErrNoSession)
+	var id int
+	assert.ErrorIs(t, row.Scan(&id), ErrNoSession)
+
+	assert.ErrorIs(t, InTransaction(ctx, func(ctx context.Context) error { return nil }), ErrNoSession)
+}
@@ -0,0 +1,250 @@
+// Package batch runs backfills and data migrations in chunks, each processed in its own
+// transaction, so that a large job neither holds its locks nor grows the transaction log
+// until it completes.
+//
+// Every chunk records a checkpoint in the transaction processing it, so the checkpoint is
+// committed if and only if the writes of the chunk are. A job interrupted by a failure or a
+// crash resumes after the chunks already committed when it is run again.
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// ErrNoProgress is returned when a source returns a chunk without advancing its position,
+// which would process the same chunk forever.
+var ErrNoProgress = errors.New("batch: source did not advance")
+
+// Source returns the chunk of at most limit items following the position after, and the
+// position following the chunk. The position of the first chunk is the empty string.
+// An empty chunk ends the job.
+//
+// Positions are typically the last key of the chunk, with items selected in key order:
+// a source must return the same chunks when called again with the same positions.
+type Source[T any] func(ctx context.Context, after string, limit int) (items []T, next string, err error)
+
+// Progress of a job.
+type Progress struct {
+	// Chunks is the number of chunks processed by the run.
+	Chunks int
+	// Items is the number of items processed by the run.
+	Items int
+	// Resumed is the number of chunks skipped because a previous run processed them.
+	Resumed int
+	// Elapsed is the time since the run started.
+	Elapsed time.Duration
+}
+
+// Config of a runner.
+type Config struct {
+	// Table holding the checkpoints. Defaults to "batch_checkpoints".
+	Table string
+
+	// ChunkSize is the number of items requested from the source for every chunk. Defaults to 1000.
+	ChunkSize int
+
+	// Concurrency is the number of chunks processed at the same time. Defaults to 1.
+	Concurrency int
+
+	// Throttle is the minimum interval between the start of two chunks. Defaults to none.
+	Throttle time.Duration
+
+	// OnProgress is called after every chunk committed or skipped. Calls are serialized.
+	OnProgress func(Progress)
+}
+
+// Runner runs jobs in chunks.
+type Runner struct {
+	session txctx.Session
+	cfg     Config
+	now     func() time.Time
+}
+
+// New creates a new runner using the given session. Its statements are written for the
+// dialect of the session, see `txctx.WithDialect()`.
+func New(session txctx.Session, cfg Config) *Runner {
+	if cfg.Table == "" {
+		cfg.Table = "batch_checkpoints"
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 1000
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	return &Runner{
+		session: session,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+type chunk[T any] struct {
+	start, end string
+	items      []T
+}
+
+// Run runs the job with the given name: it reads the items from the source in chunks and
+// processes every chunk in its own transaction, along with its checkpoint. The chunks
+// committed by a previous run of the job are skipped.
+//
+// The source is read outside of any transaction, and one chunk at a time. With a concurrency
+// above one, several chunks are processed at the same time, so they must not conflict.
+//
+// Run returns once the source is exhausted, or with the first error of the source or of a
+// chunk, after the chunks in progress completed. The chunks committed until then are kept.
+func Run[T any](ctx context.Context, r *Runner, name string, source Source[T], process func(ctx context.Context, items []T) error) (Progress, error) {
+	done, err := r.checkpoints(ctx, name)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		progress Progress
+		runErr   error
+		started  = r.now()
+	)
+	report := func(update func(p *Progress)) {
+		mu.Lock()
+		defer mu.Unlock()
+		update(&progress)
+		progress.Elapsed = r.now().Sub(started)
+		if r.cfg.OnProgress != nil {
+			r.cfg.OnProgress(progress)
+		}
+	}
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if runErr == nil {
+			runErr = err
+			cancel()
+		}
+	}
+
+	chunks := make(chan chunk[T])
+	var wg sync.WaitGroup
+	for i := 0; i < r.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := r.process(ctx, name, c.start, c.end, len(c.items), func(ctx context.Context) error {
+					return process(ctx, c.items)
+				}); err != nil {
+					fail(err)
+					continue
+				}
+				report(func(p *Progress) {
+					p.Chunks++
+					p.Items += len(c.items)
+				})
+			}
+		}()
+	}
+
+	// The chunks are read one at a time: the position of a chunk is only known once the
+	// previous one was read.
+	var last time.Time
+	after := ""
+read:
+	for ctx.Err() == nil {
+		if next, ok := done[after]; ok {
+			report(func(p *Progress) { p.Resumed++ })
+			after = next
+			continue
+		}
+		if r.cfg.Throttle > 0 && !last.IsZero() {
+			select {
+			case <-ctx.Done():
+				break read
+			case <-time.After(time.Until(last.Add(r.cfg.Throttle))):
+			}
+		}
+
+		items, next, err := source(ctx, after, r.cfg.ChunkSize)
+		if err != nil {
+			fail(err)
+			break
+		}
+		if len(items) == 0 {
+			break
+		}
+		if next == after {
+			fail(fmt.Errorf("%w: position %q", ErrNoProgress, after))
+			break
+		}
+		last = time.Now()
+		select {
+		case <-ctx.Done():
+			break read
+		case chunks <- chunk[T]{start: after, end: next, items: items}:
+		}
+		after = next
+	}
+	close(chunks)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runErr == nil {
+		runErr = ctx.Err()
+	}
+	return progress, runErr
+}
+
+// process runs the function in a transaction recording the checkpoint of the chunk.
+func (r *Runner) process(ctx context.Context, name, start, end string, items int, f func(ctx context.Context) error) error {
+	return r.session.Transaction(ctx, func(ctx context.Context) error {
+		if err := f(ctx); err != nil {
+			return err
+		}
+		_, err := r.session.QueryPerformer(ctx).ExecContext(ctx,
+			r.query("INSERT INTO %s (name, chunk_start, chunk_end, items, completed_at) VALUES (?, ?, ?, ?, ?)"),
+			name, start, end, items, r.now())
+		return err
+	})
+}
+
+// checkpoints returns the end of the chunks of the job already processed, by start.
+func (r *Runner) checkpoints(ctx context.Context, name string) (map[string]string, error) {
+	rows, err := r.session.QueryPerformer(ctx).QueryContext(ctx,
+		r.query("SELECT chunk_start, chunk_end FROM %s WHERE name = ?"), name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[string]string)
+	for rows.Next() {
+		var start, end string
+		if err := rows.Scan(&start, &end); err != nil {
+			return nil, err
+		}
+		done[start] = end
+	}
+	return done, rows.Err()
+}
+
+// Reset deletes the checkpoints of the job, so that its next run starts over.
+func (r *Runner) Reset(ctx context.Context, name string) error {
+	_, err := r.session.QueryPerformer(ctx).ExecContext(ctx, r.query("DELETE FROM %s WHERE name = ?"), name)
+	return err
+}
+
+func (r *Runner) query(query string) string {
+	return txctx.DialectOf(r.session).Rebind(fmt.Sprintf(query, r.cfg.Table))
+}
@@ -0,0 +1,188 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func newTestRunner(t *testing.T, cfg Config, options ...txctx.Option) (*Runner, sqlmock.Sqlmock) {
+	session, mock := txtest.Session(t, options...)
+	r := New(session, cfg)
+	r.now = txtest.Clock
+	return r, mock
+}
+
+// idSource returns a source of the given IDs, positioned by the last ID of every chunk.
+func idSource(ids []int, calls *[]string) Source[int] {
+	var mu sync.Mutex
+	return func(ctx context.Context, after string, limit int) ([]int, string, error) {
+		mu.Lock()
+		*calls = append(*calls, after)
+		mu.Unlock()
+
+		from := 0
+		if after != "" {
+			last, err := strconv.Atoi(after)
+			if err != nil {
+				return nil, "", err
+			}
+			from = slices.Index(ids, last) + 1
+		}
+		chunk := ids[from:min(from+limit, len(ids))]
+		if len(chunk) == 0 {
+			return nil, after, nil
+		}
+		return chunk, strconv.Itoa(chunk[len(chunk)-1]), nil
+	}
+}
+
+func expectCheckpoints(mock sqlmock.Sqlmock, name string, rows ...[2]string) {
+	result := sqlmock.NewRows([]string{"chunk_start", "chunk_end"})
+	for _, r := range rows {
+		result.AddRow(r[0], r[1])
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT chunk_start, chunk_end FROM batch_checkpoints WHERE name = $1")).
+		WithArgs(name).
+		WillReturnRows(result)
+}
+
+func expectChunk(mock sqlmock.Sqlmock, name, start, end string, items int) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, int64(items)))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO batch_checkpoints (name, chunk_start, chunk_end, items, completed_at) VALUES ($1, $2, $3, $4, $5)")).
+		WithArgs(name, start, end, items, txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func backfill(r *Runner) func(ctx context.Context, ids []int) error {
+	return func(ctx context.Context, ids []int) error {
+		_, err := r.session.QueryPerformer(ctx).ExecContext(ctx, "UPDATE users SET verified = true WHERE id = ANY($1)", len(ids))
+		return err
+	}
+}
+
+func TestRun(t *testing.T) {
+	var reports []Progress
+	r, mock := newTestRunner(t, Config{ChunkSize: 2, OnProgress: func(p Progress) {
+		reports = append(reports, p)
+	}})
+
+	expectCheckpoints(mock, "verify-users")
+	expectChunk(mock, "verify-users", "", "2", 2)
+	expectChunk(mock, "verify-users", "2", "4", 2)
+	expectChunk(mock, "verify-users", "4", "5", 1)
+
+	var calls []string
+	progress, err := Run(context.Background(), r, "verify-users", idSource([]int{1, 2, 3, 4, 5}, &calls), backfill(r))
+
+	require.NoError(t, err)
+	assert.Equal(t, Progress{Chunks: 3, Items: 5}, progress)
+	assert.Equal(t, []string{"", "2", "4", "5"}, calls)
+	assert.Equal(t, []Progress{{Chunks: 1, Items: 2}, {Chunks: 2, Items: 4}, {Chunks: 3, Items: 5}}, reports)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_Resume(t *testing.T) {
+	r, mock := newTestRunner(t, Config{ChunkSize: 2})
+
+	expectCheckpoints(mock, "verify-users", [2]string{"", "2"}, [2]string{"2", "4"})
+	expectChunk(mock, "verify-users", "4", "5", 1)
+
+	var calls []string
+	progress, err := Run(context.Background(), r, "verify-users", idSource([]int{1, 2, 3, 4, 5}, &calls), backfill(r))
+
+	require.NoError(t, err)
+	assert.Equal(t, Progress{Chunks: 1, Items: 1, Resumed: 2}, progress)
+	assert.Equal(t, []string{"4", "5"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_ChunkFailure(t *testing.T) {
+	r, mock := newTestRunner(t, Config{ChunkSize: 2})
+	chunkErr := errors.New("check constraint violated")
+
+	expectCheckpoints(mock, "verify-users")
+	expectChunk(mock, "verify-users", "", "2", 2)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnError(chunkErr)
+	mock.ExpectRollback()
+
+	var calls []string
+	progress, err := Run(context.Background(), r, "verify-users", idSource([]int{1, 2, 3, 4, 5}, &calls), backfill(r))
+
+	assert.ErrorIs(t, err, chunkErr)
+	assert.Equal(t, Progress{Chunks: 1, Items: 2}, progress)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_SourceErrors(t *testing.T) {
+	r, mock := newTestRunner(t, Config{})
+	sourceErr := errors.New("connection refused")
+
+	expectCheckpoints(mock, "failing")
+	_, err := Run(context.Background(), r, "failing", func(ctx context.Context, after string, limit int) ([]int, string, error) {
+		return nil, "", sourceErr
+	}, backfill(r))
+	assert.ErrorIs(t, err, sourceErr)
+
+	expectCheckpoints(mock, "stuck")
+	_, err = Run(context.Background(), r, "stuck", func(ctx context.Context, after string, limit int) ([]int, string, error) {
+		return []int{1}, "", nil
+	}, backfill(r))
+	assert.ErrorIs(t, err, ErrNoProgress)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_ConcurrencyAndThrottle(t *testing.T) {
+	r, mock := newTestRunner(t, Config{
+		Table:       "checkpoints",
+		ChunkSize:   1,
+		Concurrency: 3,
+		Throttle:    10 * time.Millisecond,
+	}, txctx.WithDialect(txctx.SQLite))
+	mock.MatchExpectationsInOrder(false)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT chunk_start, chunk_end FROM checkpoints WHERE name = ?")).
+		WillReturnRows(sqlmock.NewRows([]string{"chunk_start", "chunk_end"}))
+	for i := 1; i <= 3; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO checkpoints (name, chunk_start, chunk_end, items, completed_at) VALUES (?, ?, ?, ?, ?)")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	var calls []string
+	started := time.Now()
+	progress, err := Run(context.Background(), r, "verify-users", idSource([]int{1, 2, 3}, &calls), backfill(r))
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, progress.Chunks)
+	assert.GreaterOrEqual(t, time.Since(started), 20*time.Millisecond)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunner_Reset(t *testing.T) {
+	r, mock := newTestRunner(t, Config{})
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM batch_checkpoints WHERE name = $1")).
+		WithArgs("verify-users").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	require.NoError(t, r.Reset(context.Background(), "verify-users"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,51 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Schema returns the statements creating the table of checkpoints for the given dialect.
+func Schema(d txctx.Dialect, table string) []string {
+	switch d {
+	case txctx.MySQL:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(255) NOT NULL,
+	chunk_start VARCHAR(255) NOT NULL,
+	chunk_end VARCHAR(255) NOT NULL,
+	items INT NOT NULL,
+	completed_at DATETIME(6) NOT NULL,
+	PRIMARY KEY (name, chunk_start)
+)`, table)}
+	case txctx.SQLite:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name TEXT NOT NULL,
+	chunk_start TEXT NOT NULL,
+	chunk_end TEXT NOT NULL,
+	items INTEGER NOT NULL,
+	completed_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (name, chunk_start)
+)`, table)}
+	}
+	return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(255) NOT NULL,
+	chunk_start TEXT NOT NULL,
+	chunk_end TEXT NOT NULL,
+	items INTEGER NOT NULL,
+	completed_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (name, chunk_start)
+)`, table)}
+}
+
+// CreateTable creates the table of checkpoints if it doesn't exist.
+func (r *Runner) CreateTable(ctx context.Context) error {
+	p := r.session.QueryPerformer(ctx)
+	for _, stmt := range Schema(txctx.DialectOf(r.session), r.cfg.Table) {
+		if _, err := p.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package batch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestSchema(t *testing.T) {
+	// A chunk processed twice fails to record its checkpoint, rolling back its writes.
+	tests := []struct {
+		dialect txctx.Dialect
+		defs    []string
+	}{
+		{txctx.Postgres, []string{"chunk_start TEXT NOT NULL", "completed_at TIMESTAMPTZ NOT NULL", "PRIMARY KEY (name, chunk_start)"}},
+		// MySQL cannot index TEXT columns without a prefix length.
+		{txctx.MySQL, []string{"chunk_start VARCHAR(255) NOT NULL", "completed_at DATETIME(6) NOT NULL", "PRIMARY KEY (name, chunk_start)"}},
+		{txctx.SQLite, []string{"chunk_start TEXT NOT NULL", "completed_at TIMESTAMP NOT NULL", "PRIMARY KEY (name, chunk_start)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			stmts := Schema(tt.dialect, "checkpoints")
+			require.Len(t, stmts, 1)
+			assert.Subset(t, txtest.Definitions(stmts[0]), tt.defs)
+		})
+	}
+}
+
+func TestRunner_CreateTable(t *testing.T) {
+	r, mock := newTestRunner(t, Config{Table: "chunks"}, txctx.WithDialect(txctx.MySQL))
+	mock.ExpectExec(`(?s)^CREATE TABLE IF NOT EXISTS chunks \(.*chunk_start VARCHAR\(255\) NOT NULL,.*\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, r.CreateTable(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,261 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrNotFlushed is returned by the result of a statement still queued in its batch.
+	ErrNotFlushed = errors.New("txctx: batch statement not flushed")
+	// ErrNotExecuted is returned by the result of a statement that was not executed because
+	// a previous statement of its batch failed.
+	ErrNotExecuted = errors.New("txctx: batch statement not executed: a previous statement failed")
+	// ErrDiscarded is returned by the result of a statement discarded because the savepoint
+	// it was queued in was rolled back before it was flushed.
+	ErrDiscarded = errors.New("txctx: batch statement discarded: its savepoint was rolled back")
+)
+
+// maxParams is the number of parameters a statement can have, by dialect.
+var maxParams = map[Dialect]int{
+	Postgres:  65535,
+	MySQL:     65535,
+	SQLite:    32766,
+	SQLServer: 2100,
+}
+
+// Batch queues statements in the transaction in the context and executes them together,
+// to save the round trips of executing them one at a time.
+//
+// Consecutive rows queued with `Insert()` for the same table and columns are executed as a
+// multi-row INSERT, within the limit of parameters of the dialect. Other statements are
+// executed in the order they were queued.
+//
+// The batch is flushed when it holds the number of statements it was created with, and
+// before the transaction commits. Once a statement fails, the statements following it are
+// not executed and every later flush, including the one before commit, returns its error.
+//
+// The statements queued within a savepoint that is rolled back are discarded if they were not
+// flushed yet. If a statement of the savepoint failed, the batch is usable again.
+//
+// A batch is not safe for concurrent use.
+type Batch struct {
+	t         *transaction
+	p         Performer
+	flushSize int
+	pending   []*batchStatement
+	err       error
+
+	// seq numbers the statements queued, errSeq is the number of the statement that failed.
+	seq    int
+	errSeq int
+	// savepoints are the savepoints the batch discards its statements of on rollback.
+	savepoints map[*savepoint]bool
+}
+
+type batchStatement struct {
+	seq   int
+	query string
+	args  []any
+
+	// Set for the rows queued with `Insert()`.
+	table   string
+	columns []string
+
+	result *BatchResult
+}
+
+// BatchResult is the result of a statement queued in a batch, available once it is flushed.
+type BatchResult struct {
+	rows int64
+	err  error
+}
+
+// RowsAffected returns the number of rows affected by the statement, or its error.
+// It returns `ErrNotFlushed` while the statement is queued.
+func (r *BatchResult) RowsAffected() (int64, error) {
+	return r.rows, r.err
+}
+
+// Err returns the error of the statement, or `ErrNotFlushed` while it is queued.
+func (r *BatchResult) Err() error {
+	return r.err
+}
+
+// NewBatch creates a batch of statements for the transaction in the context, flushed every
+// flushSize statements. The flush size defaults to 1000.
+// `ErrNoTransaction` is returned if the context holds no transaction.
+func NewBatch(ctx context.Context, flushSize int) (*Batch, error) {
+	t, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if flushSize <= 0 {
+		flushSize = 1000
+	}
+	b := &Batch{t: t, p: t.performer(), flushSize: flushSize}
+	// The batch outlives the savepoint it may be created in.
+	if err := BeforeCommit(WithoutSavepoint(ctx), b.Flush); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Queue queues a statement, written with the placeholders of the dialect.
+func (b *Batch) Queue(ctx context.Context, query string, args ...any) *BatchResult {
+	return b.queue(ctx, &batchStatement{query: query, args: args})
+}
+
+// Insert queues the insertion of a row with the given columns and values.
+func (b *Batch) Insert(ctx context.Context, table string, columns []string, values ...any) *BatchResult {
+	if len(columns) == 0 {
+		return &BatchResult{err: errors.New("txctx: no columns to insert")}
+	}
+	if len(values) != len(columns) {
+		return &BatchResult{err: fmt.Errorf("txctx: %d values for %d columns", len(values), len(columns))}
+	}
+	return b.queue(ctx, &batchStatement{table: table, columns: columns, args: values})
+}
+
+func (b *Batch) queue(ctx context.Context, s *batchStatement) *BatchResult {
+	s.result = &BatchResult{err: ErrNotFlushed}
+	if b.err != nil {
+		s.result.err = ErrNotExecuted
+		return s.result
+	}
+	b.scope(ctx)
+	b.seq++
+	s.seq = b.seq
+	b.pending = append(b.pending, s)
+	if len(b.pending) >= b.flushSize {
+		_ = b.Flush(ctx)
+	}
+	return s.result
+}
+
+// Len returns the number of statements queued.
+func (b *Batch) Len() int {
+	return len(b.pending)
+}
+
+// Flush executes the statements queued and reports their results. It returns the error
+// of the first statement that failed, in this flush or a previous one, reported with its
+// position in the flush.
+func (b *Batch) Flush(ctx context.Context) error {
+	pending := b.pending
+	b.pending = nil
+	if b.err != nil {
+		for _, s := range pending {
+			s.result.err = ErrNotExecuted
+		}
+		return b.err
+	}
+
+	for i := 0; i < len(pending); {
+		group := b.group(pending[i:])
+		query, args := group[0].query, group[0].args
+		if group[0].table != "" {
+			query, args = b.insert(group)
+		}
+
+		res, err := b.p.ExecContext(ctx, query, args...)
+		var rows int64
+		if err == nil && group[0].table == "" {
+			rows, err = res.RowsAffected()
+		}
+		if err != nil {
+			b.err = fmt.Errorf("txctx: batch statement %d: %w", i, err)
+			b.errSeq = group[0].seq
+			for _, s := range group {
+				s.result.err = err
+			}
+			for _, s := range pending[i+len(group):] {
+				s.result.err = ErrNotExecuted
+			}
+			return b.err
+		}
+
+		for _, s := range group {
+			s.result.rows, s.result.err = 1, nil
+		}
+		if group[0].table == "" {
+			group[0].result.rows = rows
+		}
+		i += len(group)
+	}
+	return nil
+}
+
+// scope discards the statements queued from now on if the savepoint in progress in the
+// context is rolled back.
+func (b *Batch) scope(ctx context.Context) {
+	b.t.hooks.mu.Lock()
+	sp := innermost(ctx, b.t)
+	b.t.hooks.mu.Unlock()
+	if sp == nil || b.savepoints[sp] {
+		return
+	}
+	if b.savepoints == nil {
+		b.savepoints = make(map[*savepoint]bool)
+	}
+	b.savepoints[sp] = true
+	from := b.seq + 1
+	_ = AfterRollback(ctx, func(context.Context) {
+		b.discard(from)
+	})
+}
+
+// discard drops the statements numbered from the given number that are still queued, and
+// the error of a statement among them.
+func (b *Batch) discard(from int) {
+	pending := b.pending[:0]
+	for _, s := range b.pending {
+		if s.seq >= from {
+			s.result.err = ErrDiscarded
+		} else {
+			pending = append(pending, s)
+		}
+	}
+	b.pending = pending
+	if b.err != nil && b.errSeq >= from {
+		b.err = nil
+	}
+}
+
+// group returns the statements executed with the first one: the following rows inserted
+// in the same table and columns, within the limit of parameters of the dialect.
+func (b *Batch) group(pending []*batchStatement) []*batchStatement {
+	first := pending[0]
+	if first.table == "" {
+		return pending[:1]
+	}
+	limit := maxParams[b.dialect()] / len(first.columns)
+	n := 1
+	for n < len(pending) && n < limit && pending[n].table == first.table && slices.Equal(pending[n].columns, first.columns) {
+		n++
+	}
+	return pending[:n]
+}
+
+// insert returns the multi-row INSERT of the rows.
+func (b *Batch) insert(rows []*batchStatement) (string, []any) {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(rows[0].columns)), ", ") + ")"
+	values := make([]string, len(rows))
+	args := make([]any, 0, len(rows)*len(rows[0].columns))
+	for i, s := range rows {
+		values[i] = row
+		args = append(args, s.args...)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", rows[0].table, strings.Join(rows[0].columns, ", "), strings.Join(values, ", "))
+	return b.dialect().Rebind(query), args
+}
+
+func (b *Batch) dialect() Dialect {
+	if b.t.dialect == 0 {
+		return Postgres
+	}
+	return b.t.dialect
+}
@@ -0,0 +1,217 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4)")).
+		WithArgs(1, "John", 2, "Jane").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE teams SET size = size + 2 WHERE id = $1")).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, name) VALUES ($1, $2)")).
+		WithArgs(3, "Jack").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var results []*BatchResult
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		b, err := NewBatch(ctx, 0)
+		if err != nil {
+			return err
+		}
+		results = append(results,
+			b.Insert(ctx, "users", []string{"id", "name"}, 1, "John"),
+			b.Insert(ctx, "users", []string{"id", "name"}, 2, "Jane"),
+			b.Queue(ctx, "UPDATE teams SET size = size + 2 WHERE id = $1", 7),
+			b.Insert(ctx, "users", []string{"id", "name"}, 3, "Jack"),
+		)
+		assert.Equal(t, 4, b.Len())
+		assert.ErrorIs(t, results[0].Err(), ErrNotFlushed)
+		return nil
+	})
+	require.NoError(t, err)
+
+	for _, r := range results {
+		n, err := r.RowsAffected()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatch_AutoFlush(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithDialect(SQLServer))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (kind) VALUES (@p1), (@p2)")).
+		WithArgs("a", "b").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (kind) VALUES (@p1)")).
+		WithArgs("c").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		b, err := NewBatch(ctx, 2)
+		if err != nil {
+			return err
+		}
+		b.Insert(ctx, "events", []string{"kind"}, "a")
+		r := b.Insert(ctx, "events", []string{"kind"}, "b")
+		assert.NoError(t, r.Err())
+		assert.Equal(t, 0, b.Len())
+
+		b.Insert(ctx, "events", []string{"kind"}, "c")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatch_Failure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithDialect(MySQL))
+	dupErr := errors.New("Duplicate entry '1' for key 'PRIMARY'")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = ?")).
+		WithArgs(9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id) VALUES (?), (?)")).
+		WithArgs(1, 1).
+		WillReturnError(dupErr)
+	mock.ExpectRollback()
+
+	var results []*BatchResult
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		b, err := NewBatch(ctx, 0)
+		if err != nil {
+			return err
+		}
+		results = append(results,
+			b.Queue(ctx, "DELETE FROM users WHERE id = ?", 9),
+			b.Insert(ctx, "users", []string{"id"}, 1),
+			b.Insert(ctx, "users", []string{"id"}, 1),
+			b.Queue(ctx, "UPDATE stats SET users = users + 2"),
+			b.Insert(ctx, "users", []string{"id", "name"}, 2),
+		)
+		return nil
+	})
+	assert.ErrorIs(t, err, dupErr)
+	assert.ErrorContains(t, err, "txctx: batch statement 1")
+
+	n, err := results[0].RowsAffected()
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.ErrorIs(t, results[1].Err(), dupErr)
+	assert.ErrorIs(t, results[2].Err(), dupErr)
+	assert.ErrorIs(t, results[3].Err(), ErrNotExecuted)
+	assert.EqualError(t, results[4].Err(), "txctx: 1 values for 2 columns")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatch_CreatedInSavepointRolledBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (kind) VALUES ($1)")).
+		WithArgs("b").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		var b *Batch
+		err := Savepoint(ctx, func(ctx context.Context) error {
+			var err error
+			if b, err = NewBatch(ctx, 0); err != nil {
+				return err
+			}
+			return errors.New("rolled back")
+		})
+		require.Error(t, err)
+
+		b.Insert(ctx, "events", []string{"kind"}, "b")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatch_QueuedInSavepointRolledBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT txctx_sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT txctx_sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (kind) VALUES ($1), ($2)")).
+		WithArgs("a", "d").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	var discarded []*BatchResult
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		b, err := NewBatch(ctx, 0)
+		require.NoError(t, err)
+
+		b.Insert(ctx, "events", []string{"kind"}, "a")
+		err = Savepoint(ctx, func(ctx context.Context) error {
+			discarded = append(discarded, b.Insert(ctx, "events", []string{"kind"}, "b"))
+			require.NoError(t, Savepoint(ctx, func(ctx context.Context) error {
+				discarded = append(discarded, b.Insert(ctx, "events", []string{"kind"}, "c"))
+				return nil
+			}))
+			return errors.New("rolled back")
+		})
+		require.Error(t, err)
+		assert.Equal(t, 1, b.Len())
+
+		b.Insert(ctx, "events", []string{"kind"}, "d")
+		return nil
+	})
+	require.NoError(t, err)
+	for _, r := range discarded {
+		assert.ErrorIs(t, r.Err(), ErrDiscarded)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewBatch_NoTransaction(t *testing.T) {
+	_, err := NewBatch(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrNoTransaction)
+}
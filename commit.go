@@ -0,0 +1,94 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrCommitOutcomeUnknown is returned when the connection was lost while committing.
+// The transaction may or may not have been committed: retrying it blindly could apply
+// its changes twice. Use `VerifyCommit()` to resolve the actual outcome.
+var ErrCommitOutcomeUnknown = errors.New("txctx: commit outcome unknown")
+
+// WithBackendTxID makes the session capture the ID assigned by the database to every
+// transaction it starts, by running the given query right after the transaction begins.
+// The ID is reported in *TxError and allows `VerifyCommit()` to resolve the outcome of
+// a commit with `TxidStatus()`.
+//
+// For Postgres, use "SELECT txid_current()" or "SELECT pg_current_xact_id()" (13+).
+func WithBackendTxID(query string) Option {
+	return func(s *SQLSession) {
+		s.backendTxID = query
+	}
+}
+
+// CommitVerifier resolves the outcome of a transaction whose commit failed with
+// `ErrCommitOutcomeUnknown`. It is given the performer of the root session and the
+// transaction ID captured with `WithBackendTxID()`, if any.
+type CommitVerifier func(ctx context.Context, p Performer, backendID string) (committed bool, err error)
+
+// TxidStatus verifies the outcome of a commit with Postgres' txid_status().
+// The session must capture the transaction IDs with `WithBackendTxID()`.
+func TxidStatus() CommitVerifier {
+	return func(ctx context.Context, p Performer, backendID string) (bool, error) {
+		if backendID == "" {
+			return false, fmt.Errorf("%w: no backend transaction ID, see WithBackendTxID", ErrCommitOutcomeUnknown)
+		}
+		id, err := strconv.ParseInt(backendID, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("txctx: invalid backend transaction ID %q: %w", backendID, err)
+		}
+
+		var status *string
+		if err := p.QueryRowContext(ctx, "SELECT txid_status($1)", id).Scan(&status); err != nil {
+			return false, err
+		}
+		switch {
+		case status == nil:
+			return false, fmt.Errorf("%w: transaction %s is too old", ErrCommitOutcomeUnknown, backendID)
+		case *status == "committed":
+			return true, nil
+		case *status == "aborted":
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: transaction %s is %s", ErrCommitOutcomeUnknown, backendID, *status)
+	}
+}
+
+// MarkerRow verifies the outcome of a commit by looking for a row written by the
+// transaction, such as a payment or an idempotency record. The transaction is considered
+// committed if the given query returns at least one row.
+func MarkerRow(query string, args ...interface{}) CommitVerifier {
+	return func(ctx context.Context, p Performer, _ string) (bool, error) {
+		rows, err := p.QueryContext(ctx, query, args...)
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+
+		found := rows.Next()
+		return found, rows.Err()
+	}
+}
+
+// VerifyCommit resolves the outcome of the transaction that returned the given error.
+// If the error is nil the transaction was committed. If it doesn't wrap
+// `ErrCommitOutcomeUnknown` it was not. Otherwise, the verifier is run outside any
+// transaction to find out.
+func (s SQLSession) VerifyCommit(ctx context.Context, err error, verify CommitVerifier) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, ErrCommitOutcomeUnknown) {
+		return false, nil
+	}
+
+	var backendID string
+	var txErr *TxError
+	if errors.As(err, &txErr) {
+		backendID = txErr.BackendID
+	}
+	return verify(ctx, s.db, backendID)
+}
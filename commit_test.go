@@ -0,0 +1,192 @@
+package txctx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLSession_Commit_OutcomeUnknown(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithBackendTxID("SELECT txid_current()"))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT txid_current()").WillReturnRows(sqlmock.NewRows([]string{"txid_current"}).AddRow(1234))
+	mock.ExpectCommit().WillReturnError(driver.ErrBadConn)
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+
+	assert.ErrorIs(t, err, ErrCommitOutcomeUnknown)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseCommit, txErr.Phase)
+	assert.Equal(t, "1234", txErr.BackendID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_Commit_DefiniteFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("could not serialize access"))
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCommitOutcomeUnknown)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_Commit_CanceledBeforeCommit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	child, err := session.Begin(ctx)
+	require.NoError(t, err)
+
+	cancel()
+	err = child.Commit()
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrCommitOutcomeUnknown)
+	assert.Equal(t, StateRolledBack, child.(StatefulSession).State())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_BackendTxID_Error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithBackendTxID("SELECT txid_current()"))
+	queryErr := errors.New("function txid_current() does not exist")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT txid_current()").WillReturnError(queryErr)
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	assert.Nil(t, child)
+	assert.ErrorIs(t, err, queryErr)
+
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseBegin, txErr.Phase)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_VerifyCommit(t *testing.T) {
+	unknown := &TxError{Phase: PhaseCommit, Err: ErrCommitOutcomeUnknown, BackendID: "1234"}
+
+	t.Run("no error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		committed, err := SQL(db, nil).VerifyCommit(context.Background(), nil, TxidStatus())
+		assert.NoError(t, err)
+		assert.True(t, committed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("definite failure", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		committed, err := SQL(db, nil).VerifyCommit(context.Background(), errors.New("boom"), TxidStatus())
+		assert.NoError(t, err)
+		assert.False(t, committed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	statuses := []struct {
+		status    interface{}
+		committed bool
+		unknown   bool
+	}{
+		{status: "committed", committed: true},
+		{status: "aborted", committed: false},
+		{status: "in progress", unknown: true},
+		{status: nil, unknown: true},
+	}
+	for _, tt := range statuses {
+		t.Run("txid_status", func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT txid_status").
+				WithArgs(int64(1234)).
+				WillReturnRows(sqlmock.NewRows([]string{"txid_status"}).AddRow(tt.status))
+
+			committed, err := SQL(db, nil).VerifyCommit(context.Background(), unknown, TxidStatus())
+			if tt.unknown {
+				assert.ErrorIs(t, err, ErrCommitOutcomeUnknown)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.committed, committed)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("txid_status without backend ID", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = &TxError{Phase: PhaseCommit, Err: ErrCommitOutcomeUnknown}
+		_, err = SQL(db, nil).VerifyCommit(context.Background(), err, TxidStatus())
+		assert.ErrorIs(t, err, ErrCommitOutcomeUnknown)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("marker row", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT 1 FROM payments").
+			WithArgs("pay_1").
+			WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+		mock.ExpectQuery("SELECT 1 FROM payments").
+			WithArgs("pay_2").
+			WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+		session := SQL(db, nil)
+		committed, err := session.VerifyCommit(context.Background(), unknown, MarkerRow("SELECT 1 FROM payments WHERE id = ?", "pay_1"))
+		assert.NoError(t, err)
+		assert.True(t, committed)
+
+		committed, err = session.VerifyCommit(context.Background(), unknown, MarkerRow("SELECT 1 FROM payments WHERE id = ?", "pay_2"))
+		assert.NoError(t, err)
+		assert.False(t, committed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,209 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"sync/atomic"
+)
+
+// ErrCursorClosed is returned when fetching from a closed cursor.
+var ErrCursorClosed = errors.New("txctx: cursor closed")
+
+// cursorSerials numbers the cursors declared in the process, to name them.
+var cursorSerials atomic.Uint64
+
+// CursorOptions configures a cursor opened with `OpenCursor()`.
+type CursorOptions struct {
+	// Name of the cursor, a SQL identifier. Defaults to a name unique in the process.
+	Name string
+	// BatchSize is the number of rows fetched at once. Defaults to 1000.
+	BatchSize int
+	// KeyColumn enables keyset pagination on the databases without server-side cursors.
+	// It is a column of the query with unique values, such as the primary key: the rows are
+	// fetched in its order, by queries selecting the rows following the last one fetched.
+	KeyColumn string
+}
+
+// Cursor reads the rows of a query in batches within a transaction, scanned into Ts like
+// in `QueryOne()`.
+//
+// On Postgres the query is run by a server-side cursor, so that the database only sends
+// the rows of the batch being fetched. Other databases fall back to keyset pagination,
+// see `CursorOptions.KeyColumn`.
+type Cursor[T any] struct {
+	t     *transaction
+	p     Performer
+	query string
+	args  []any
+	opts  CursorOptions
+
+	// Keyset pagination, when the dialect has no cursors.
+	keyset  bool
+	keyPath []int
+	last    any
+
+	started bool
+	done    bool
+	closed  bool
+}
+
+// OpenCursor opens a cursor for the query in the transaction in the context.
+// On Postgres, the cursor is declared right away. `ErrNoTransaction` is returned if the
+// context holds no transaction.
+//
+// The cursor must be closed with `Close()`, unless it is read with `All()` until the end.
+// It is closed by the database when the transaction is committed or rolled back.
+//
+// For keyset pagination, the query must not be ordered: it is used as a subquery ordered
+// by the key column.
+func OpenCursor[T any](ctx context.Context, opts CursorOptions, query string, args ...any) (*Cursor[T], error) {
+	t, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Name == "" {
+		opts.Name = fmt.Sprintf("txctx_cursor_%d", cursorSerials.Add(1))
+	}
+	c := &Cursor[T]{t: t, p: t.performer(), query: query, args: args, opts: opts}
+
+	if d := c.dialect(); d != Postgres {
+		if opts.KeyColumn == "" {
+			return nil, fmt.Errorf("txctx: %s has no cursors, set CursorOptions.KeyColumn to use keyset pagination", d)
+		}
+		c.keyset = true
+		typ := reflect.TypeFor[T]()
+		if typ.Kind() == reflect.Pointer && isMapped(typ.Elem()) {
+			typ = typ.Elem()
+		}
+		if isMapped(typ) {
+			paths, err := columnPaths(typ, []string{opts.KeyColumn})
+			if err != nil {
+				return nil, err
+			}
+			c.keyPath = paths[0]
+		}
+		return c, nil
+	}
+
+	if _, err := c.p.ExecContext(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", opts.Name, query), args...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cursor[T]) dialect() Dialect {
+	if c.t.dialect == 0 {
+		return Postgres
+	}
+	return c.t.dialect
+}
+
+// Fetch returns the next batch of rows. An empty batch is returned once every row was fetched.
+func (c *Cursor[T]) Fetch(ctx context.Context) ([]T, error) {
+	if c.closed {
+		return nil, ErrCursorClosed
+	}
+	if c.done {
+		return []T{}, nil
+	}
+
+	query, args := fmt.Sprintf("FETCH FORWARD %d FROM %s", c.opts.BatchSize, c.opts.Name), []any(nil)
+	if c.keyset {
+		query, args = c.page()
+	}
+	rows, err := c.p.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	batch, err := scanRows[T](rows, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	c.started = true
+	if len(batch) < c.opts.BatchSize {
+		c.done = true
+	}
+	if c.keyset && len(batch) > 0 {
+		c.last = c.key(batch[len(batch)-1])
+	}
+	return batch, nil
+}
+
+// All iterates over the remaining rows, fetching them in batches, and closes the cursor when
+// the iteration completes or stops early. An error is yielded once and ends the iteration.
+func (c *Cursor[T]) All(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer c.Close()
+
+		for {
+			batch, err := c.Fetch(ctx)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			if len(batch) == 0 {
+				return
+			}
+			for _, v := range batch {
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close closes the cursor. Closing a cursor twice, or after the end of its transaction,
+// is a no-op.
+func (c *Cursor[T]) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.keyset || c.t.currentState() != StateActive {
+		return nil
+	}
+	_, err := c.p.ExecContext(c.t.ctx, "CLOSE "+c.opts.Name)
+	return err
+}
+
+// page returns the query selecting the next page of rows with keyset pagination.
+func (c *Cursor[T]) page() (string, []any) {
+	args := c.args
+	var where string
+	if c.started {
+		args = append(args[:len(args):len(args)], c.last)
+		placeholder := "?"
+		if c.dialect() == SQLServer {
+			placeholder = fmt.Sprintf("@p%d", len(args))
+		}
+		where = fmt.Sprintf(" WHERE %s > %s", c.opts.KeyColumn, placeholder)
+	}
+
+	if c.dialect() == SQLServer {
+		return fmt.Sprintf("SELECT TOP (%d) * FROM (%s) AS txctx_page%s ORDER BY %s",
+			c.opts.BatchSize, c.query, where, c.opts.KeyColumn), args
+	}
+	return fmt.Sprintf("SELECT * FROM (%s) AS txctx_page%s ORDER BY %s LIMIT %d",
+		c.query, where, c.opts.KeyColumn, c.opts.BatchSize), args
+}
+
+// key returns the value of the key column of the row.
+func (c *Cursor[T]) key(v T) any {
+	rv := reflect.ValueOf(&v).Elem()
+	if c.keyPath == nil {
+		return rv.Interface()
+	}
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	return rv.FieldByIndex(c.keyPath).Interface()
+}
@@ -0,0 +1,169 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor_Postgres(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DECLARE accounts_cursor NO SCROLL CURSOR FOR SELECT id, email FROM accounts WHERE id > $1")).
+		WithArgs(0).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FETCH FORWARD 2 FROM accounts_cursor")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "a@example.com").AddRow(2, "b@example.com"))
+	mock.ExpectQuery(regexp.QuoteMeta("FETCH FORWARD 2 FROM accounts_cursor")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(3, "c@example.com"))
+	mock.ExpectExec(regexp.QuoteMeta("CLOSE accounts_cursor")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		c, err := OpenCursor[account](ctx, CursorOptions{Name: "accounts_cursor", BatchSize: 2}, "SELECT id, email FROM accounts WHERE id > $1", 0)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for a, err := range c.All(ctx) {
+			if err != nil {
+				return err
+			}
+			ids = append(ids, a.ID)
+		}
+		assert.Equal(t, []int64{1, 2, 3}, ids)
+
+		_, err = c.Fetch(ctx)
+		assert.ErrorIs(t, err, ErrCursorClosed)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCursor_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	fetchErr := errors.New("connection reset")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DECLARE txctx_cursor_[0-9]+ NO SCROLL CURSOR FOR SELECT id FROM accounts").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FETCH FORWARD 1000 FROM txctx_cursor_[0-9]+").WillReturnError(fetchErr)
+	mock.ExpectRollback()
+
+	var c *Cursor[int64]
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		c, err = OpenCursor[int64](ctx, CursorOptions{}, "SELECT id FROM accounts")
+		if err != nil {
+			return err
+		}
+		_, err := c.Fetch(ctx)
+		return err
+	})
+	assert.ErrorIs(t, err, fetchErr)
+
+	// The cursor was closed with the transaction.
+	assert.NoError(t, c.Close())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCursor_Keyset(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		first   string
+		next    string
+	}{
+		{
+			MySQL,
+			"SELECT * FROM (SELECT id, email FROM accounts WHERE email LIKE ?) AS txctx_page ORDER BY id LIMIT 2",
+			"SELECT * FROM (SELECT id, email FROM accounts WHERE email LIKE ?) AS txctx_page WHERE id > ? ORDER BY id LIMIT 2",
+		},
+		{
+			SQLServer,
+			"SELECT TOP (2) * FROM (SELECT id, email FROM accounts WHERE email LIKE @p1) AS txctx_page ORDER BY id",
+			"SELECT TOP (2) * FROM (SELECT id, email FROM accounts WHERE email LIKE @p1) AS txctx_page WHERE id > @p2 ORDER BY id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			session := SQL(db, nil, WithDialect(tt.dialect))
+			query := "SELECT id, email FROM accounts WHERE email LIKE ?"
+			if tt.dialect == SQLServer {
+				query = "SELECT id, email FROM accounts WHERE email LIKE @p1"
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(tt.first)).
+				WithArgs("%@example.com").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "a@example.com").AddRow(5, "b@example.com"))
+			mock.ExpectQuery(regexp.QuoteMeta(tt.next)).
+				WithArgs("%@example.com", int64(5)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(8, "c@example.com").AddRow(9, "d@example.com"))
+			mock.ExpectQuery(regexp.QuoteMeta(tt.next)).
+				WithArgs("%@example.com", int64(9)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email"}))
+			mock.ExpectCommit()
+
+			err = session.Transaction(context.Background(), func(ctx context.Context) error {
+				c, err := OpenCursor[*account](ctx, CursorOptions{BatchSize: 2, KeyColumn: "id"}, query, "%@example.com")
+				if err != nil {
+					return err
+				}
+				var ids []int64
+				for a, err := range c.All(ctx) {
+					if err != nil {
+						return err
+					}
+					ids = append(ids, a.ID)
+				}
+				assert.Equal(t, []int64{1, 5, 8, 9}, ids)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOpenCursor_Errors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = OpenCursor[int64](context.Background(), CursorOptions{}, "SELECT id FROM accounts")
+	assert.ErrorIs(t, err, ErrNoTransaction)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	session := SQL(db, nil, WithDialect(SQLite))
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		_, err := OpenCursor[int64](ctx, CursorOptions{}, "SELECT id FROM accounts")
+		assert.EqualError(t, err, "txctx: sqlite has no cursors, set CursorOptions.KeyColumn to use keyset pagination")
+
+		_, err = OpenCursor[account](ctx, CursorOptions{KeyColumn: "uuid"}, "SELECT id FROM accounts")
+		assert.EqualError(t, err, `txctx: no field of txctx.account for column "uuid"`)
+		return err
+	})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,231 @@
+// Package dberr classifies the errors returned by SQL drivers into normalized kinds,
+// so that retry policies, conflict handling and API error mapping don't need to know
+// the error codes of every driver.
+//
+// The supported drivers are lib/pq, pgx, go-sql-driver/mysql, mattn/go-sqlite3,
+// modernc.org/sqlite and microsoft/go-mssqldb. Driver errors are recognized by their shape, so this package
+// doesn't depend on any of them. Wrapped errors, such as the ones returned by
+// `txctx.Session.Transaction()`, are unwrapped.
+package dberr
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"reflect"
+	"syscall"
+)
+
+// Kind of database error.
+type Kind int
+
+const (
+	// Unknown is the kind of errors that could not be classified.
+	Unknown Kind = iota
+	// UniqueViolation is a unique or primary key constraint violation.
+	UniqueViolation
+	// ForeignKeyViolation is a foreign key constraint violation.
+	ForeignKeyViolation
+	// NotNullViolation is a not-null constraint violation.
+	NotNullViolation
+	// CheckViolation is a check constraint violation.
+	CheckViolation
+	// Deadlock is a deadlock detected by the database.
+	Deadlock
+	// SerializationFailure is a transaction that could not be serialized.
+	SerializationFailure
+	// LockTimeout is a lock that could not be acquired in time, or immediately with NOWAIT.
+	LockTimeout
+	// ConnectionLost is a connection that was lost or closed by the server.
+	ConnectionLost
+)
+
+func (k Kind) String() string {
+	switch k {
+	case UniqueViolation:
+		return "unique violation"
+	case ForeignKeyViolation:
+		return "foreign key violation"
+	case NotNullViolation:
+		return "not-null violation"
+	case CheckViolation:
+		return "check violation"
+	case Deadlock:
+		return "deadlock"
+	case SerializationFailure:
+		return "serialization failure"
+	case LockTimeout:
+		return "lock timeout"
+	case ConnectionLost:
+		return "connection lost"
+	}
+	return "unknown"
+}
+
+// Error is a classified database error.
+type Error struct {
+	Kind Kind
+	// Code is the driver's error code: the SQLSTATE for Postgres, the error number for MySQL
+	// and the extended result code for SQLite.
+	Code string
+	// Constraint, Table and Column are the objects involved in the error, when the driver reports them.
+	Constraint string
+	Table      string
+	Column     string
+	// Err is the driver error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.String() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify walks the error chain and classifies the first driver error found.
+// It returns nil if the error is nil or if no error of the chain could be classified.
+func Classify(err error) *Error {
+	var found *Error
+	walk(err, func(err error) bool {
+		if e, ok := err.(*Error); ok {
+			found = e
+			return true
+		}
+		for _, classify := range classifiers {
+			if e := classify(err); e != nil {
+				found = e
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// KindOf returns the kind of the error, or Unknown if it could not be classified.
+func KindOf(err error) Kind {
+	if e := Classify(err); e != nil {
+		return e.Kind
+	}
+	return Unknown
+}
+
+// IsUniqueViolation returns true if the error is a unique or primary key constraint violation.
+func IsUniqueViolation(err error) bool {
+	return KindOf(err) == UniqueViolation
+}
+
+// IsForeignKeyViolation returns true if the error is a foreign key constraint violation.
+func IsForeignKeyViolation(err error) bool {
+	return KindOf(err) == ForeignKeyViolation
+}
+
+// IsNotNullViolation returns true if the error is a not-null constraint violation.
+func IsNotNullViolation(err error) bool {
+	return KindOf(err) == NotNullViolation
+}
+
+// IsCheckViolation returns true if the error is a check constraint violation.
+func IsCheckViolation(err error) bool {
+	return KindOf(err) == CheckViolation
+}
+
+// IsDeadlock returns true if the error is a deadlock detected by the database.
+func IsDeadlock(err error) bool {
+	return KindOf(err) == Deadlock
+}
+
+// IsSerializationFailure returns true if the error is a serialization failure.
+func IsSerializationFailure(err error) bool {
+	return KindOf(err) == SerializationFailure
+}
+
+// IsLockTimeout returns true if a lock could not be acquired in time.
+func IsLockTimeout(err error) bool {
+	return KindOf(err) == LockTimeout
+}
+
+// IsConnectionLost returns true if the connection to the database was lost.
+func IsConnectionLost(err error) bool {
+	return KindOf(err) == ConnectionLost
+}
+
+// IsRetryable returns true if running the whole transaction again may succeed:
+// deadlocks, serialization failures, lock timeouts and lost connections.
+func IsRetryable(err error) bool {
+	switch KindOf(err) {
+	case Deadlock, SerializationFailure, LockTimeout, ConnectionLost:
+		return true
+	}
+	return false
+}
+
+var classifiers = []func(error) *Error{
+	classifyPostgres,
+	classifyMySQL,
+	classifySQLite,
+	classifySQLServer,
+	classifyConnection,
+}
+
+// walk calls f on every error of the chain, depth first, until f returns true.
+func walk(err error, f func(error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if f(err) {
+		return true
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return walk(u.Unwrap(), f)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			if walk(e, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func classifyConnection(err error) *Error {
+	// The context errors implement net.Error, but say nothing about the connection.
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return nil
+	}
+	if _, ok := err.(net.Error); ok {
+		return &Error{Kind: ConnectionLost, Err: err}
+	}
+	switch err {
+	case driver.ErrBadConn, io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.EPIPE:
+		return &Error{Kind: ConnectionLost, Err: err}
+	}
+	return nil
+}
+
+// structOf returns the struct value behind an error, dereferencing pointers.
+func structOf(err error) (reflect.Value, bool) {
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Struct
+}
+
+// stringField returns the first non-empty string field of the struct among the given names.
+func stringField(v reflect.Value, names ...string) string {
+	for _, name := range names {
+		f := v.FieldByName(name)
+		if f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+			return f.String()
+		}
+	}
+	return ""
+}
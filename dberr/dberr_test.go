@@ -0,0 +1,402 @@
+package dberr_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/dberr"
+)
+
+// pgError mimics *pgconn.PgError from pgx.
+type pgError struct {
+	Code           string
+	Message        string
+	ConstraintName string
+	TableName      string
+	ColumnName     string
+}
+
+func (e *pgError) Error() string    { return "ERROR: " + e.Message + " (SQLSTATE " + e.Code + ")" }
+func (e *pgError) SQLState() string { return e.Code }
+
+// pqErrorCode mimics pq.ErrorCode.
+type pqErrorCode string
+
+// pqError mimics *pq.Error from lib/pq before v1.12, without the SQLState method.
+type pqError struct {
+	Severity   string
+	Code       pqErrorCode
+	Message    string
+	Table      string
+	Column     string
+	Constraint string
+}
+
+func (e *pqError) Error() string { return "pq: " + e.Message }
+
+// mysqlError mimics *mysql.MySQLError from go-sql-driver/mysql.
+type mysqlError struct {
+	Number   uint16
+	SQLState [5]byte
+	Message  string
+}
+
+func (e *mysqlError) Error() string { return fmt.Sprintf("Error %d: %s", e.Number, e.Message) }
+
+// sqliteErrNo and sqliteErrNoExtended mimic the result code types of mattn/go-sqlite3.
+type sqliteErrNo int
+type sqliteErrNoExtended int
+
+// sqliteError mimics sqlite3.Error from mattn/go-sqlite3.
+type sqliteError struct {
+	Code         sqliteErrNo
+	ExtendedCode sqliteErrNoExtended
+	err          string
+}
+
+func (e sqliteError) Error() string { return e.err }
+
+// moderncError mimics *sqlite.Error from modernc.org/sqlite.
+type moderncError struct {
+	msg  string
+	code int
+}
+
+func (e *moderncError) Error() string { return e.msg }
+func (e *moderncError) Code() int     { return e.code }
+
+// mssqlError mimics mssql.Error from microsoft/go-mssqldb.
+type mssqlError struct {
+	Number  int32
+	State   uint8
+	Class   uint8
+	Message string
+}
+
+func (e mssqlError) Error() string { return "mssql: " + e.Message }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want *dberr.Error
+	}{
+		{
+			name: "pgx unique violation",
+			err:  &pgError{Code: "23505", Message: "duplicate key", ConstraintName: "users_email_key", TableName: "users"},
+			want: &dberr.Error{Kind: dberr.UniqueViolation, Code: "23505", Constraint: "users_email_key", Table: "users"},
+		},
+		{
+			name: "pgx foreign key violation",
+			err:  &pgError{Code: "23503", ConstraintName: "orders_user_id_fkey", TableName: "orders"},
+			want: &dberr.Error{Kind: dberr.ForeignKeyViolation, Code: "23503", Constraint: "orders_user_id_fkey", Table: "orders"},
+		},
+		{
+			name: "pgx not-null violation",
+			err:  &pgError{Code: "23502", TableName: "users", ColumnName: "email"},
+			want: &dberr.Error{Kind: dberr.NotNullViolation, Code: "23502", Table: "users", Column: "email"},
+		},
+		{
+			name: "pgx check violation",
+			err:  &pgError{Code: "23514", ConstraintName: "positive_balance"},
+			want: &dberr.Error{Kind: dberr.CheckViolation, Code: "23514", Constraint: "positive_balance"},
+		},
+		{
+			name: "pgx deadlock",
+			err:  &pgError{Code: "40P01"},
+			want: &dberr.Error{Kind: dberr.Deadlock, Code: "40P01"},
+		},
+		{
+			name: "pgx serialization failure",
+			err:  &pgError{Code: "40001"},
+			want: &dberr.Error{Kind: dberr.SerializationFailure, Code: "40001"},
+		},
+		{
+			name: "pgx lock not available",
+			err:  &pgError{Code: "55P03"},
+			want: &dberr.Error{Kind: dberr.LockTimeout, Code: "55P03"},
+		},
+		{
+			name: "pgx admin shutdown",
+			err:  &pgError{Code: "57P01"},
+			want: &dberr.Error{Kind: dberr.ConnectionLost, Code: "57P01"},
+		},
+		{
+			name: "pgx connection failure",
+			err:  &pgError{Code: "08006"},
+			want: &dberr.Error{Kind: dberr.ConnectionLost, Code: "08006"},
+		},
+		{
+			name: "pgx syntax error",
+			err:  &pgError{Code: "42601"},
+		},
+		{
+			name: "lib/pq unique violation",
+			err:  &pqError{Severity: "ERROR", Code: "23505", Constraint: "users_pkey", Table: "users"},
+			want: &dberr.Error{Kind: dberr.UniqueViolation, Code: "23505", Constraint: "users_pkey", Table: "users"},
+		},
+		{
+			name: "mysql duplicate entry",
+			err:  &mysqlError{Number: 1062, Message: "Duplicate entry 'john@example.com' for key 'users.email'"},
+			want: &dberr.Error{Kind: dberr.UniqueViolation, Code: "1062", Constraint: "email"},
+		},
+		{
+			name: "mysql foreign key violation",
+			err: &mysqlError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+				"(`shop`.`orders`, CONSTRAINT `fk_orders_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"},
+			want: &dberr.Error{Kind: dberr.ForeignKeyViolation, Code: "1452", Constraint: "fk_orders_user", Table: "orders", Column: "user_id"},
+		},
+		{
+			name: "mysql not-null violation",
+			err:  &mysqlError{Number: 1048, Message: "Column 'email' cannot be null"},
+			want: &dberr.Error{Kind: dberr.NotNullViolation, Code: "1048", Column: "email"},
+		},
+		{
+			name: "mysql check violation",
+			err:  &mysqlError{Number: 3819, Message: "Check constraint 'positive_balance' is violated."},
+			want: &dberr.Error{Kind: dberr.CheckViolation, Code: "3819", Constraint: "positive_balance"},
+		},
+		{
+			name: "mysql deadlock",
+			err:  &mysqlError{Number: 1213},
+			want: &dberr.Error{Kind: dberr.Deadlock, Code: "1213"},
+		},
+		{
+			name: "mysql lock wait timeout",
+			err:  &mysqlError{Number: 1205},
+			want: &dberr.Error{Kind: dberr.LockTimeout, Code: "1205"},
+		},
+		{
+			name: "mysql server gone away",
+			err:  &mysqlError{Number: 2006},
+			want: &dberr.Error{Kind: dberr.ConnectionLost, Code: "2006"},
+		},
+		{
+			name: "mysql invalid connection",
+			err:  errors.New("invalid connection"),
+			want: &dberr.Error{Kind: dberr.ConnectionLost},
+		},
+		{
+			name: "mysql unknown column",
+			err:  &mysqlError{Number: 1054},
+		},
+		{
+			name: "go-sqlite3 unique violation",
+			err:  sqliteError{Code: 19, ExtendedCode: 2067, err: "UNIQUE constraint failed: users.email"},
+			want: &dberr.Error{Kind: dberr.UniqueViolation, Code: "2067", Table: "users", Column: "email"},
+		},
+		{
+			name: "go-sqlite3 primary key violation",
+			err:  sqliteError{Code: 19, ExtendedCode: 1555, err: "UNIQUE constraint failed: users.id"},
+			want: &dberr.Error{Kind: dberr.UniqueViolation, Code: "1555", Table: "users", Column: "id"},
+		},
+		{
+			name: "go-sqlite3 foreign key violation",
+			err:  sqliteError{Code: 19, ExtendedCode: 787, err: "FOREIGN KEY constraint failed"},
+			want: &dberr.Error{Kind: dberr.ForeignKeyViolation, Code: "787"},
+		},
+		{
+			name: "go-sqlite3 check violation",
+			err:  sqliteError{Code: 19, ExtendedCode: 275, err: "CHECK constraint failed: positive_balance"},
+			want: &dberr.Error{Kind: dberr.CheckViolation, Code: "275", Constraint: "positive_balance"},
+		},
+		{
+			name: "go-sqlite3 busy",
+			err:  sqliteError{Code: 5, ExtendedCode: 5, err: "database is locked"},
+			want: &dberr.Error{Kind: dberr.LockTimeout, Code: "5"},
+		},
+		{
+			name: "modernc not-null violation",
+			err:  &moderncError{code: 1299, msg: "constraint failed: NOT NULL constraint failed: users.email (1299)"},
+			want: &dberr.Error{Kind: dberr.NotNullViolation, Code: "1299", Table: "users", Column: "email"},
+		},
+		{
+			name: "modernc busy snapshot",
+			err:  &moderncError{code: 517, msg: "database is locked (517)"},
+			want: &dberr.Error{Kind: dberr.LockTimeout, Code: "517"},
+		},
+		{
+			name: "mssql unique violation",
+			err: mssqlError{Number: 2627, Class: 14, Message: "Violation of UNIQUE KEY constraint 'UQ_users_email'. " +
+				"Cannot insert duplicate key in object 'dbo.users'. The duplicate key value is (john@example.com)."},
+			want: &dberr.Error{Kind: dberr.UniqueViolation, Code: "2627", Constraint: "UQ_users_email", Table: "dbo.users"},
+		},
+		{
+			name: "mssql foreign key violation",
+			err: mssqlError{Number: 547, Class: 16, Message: `The INSERT statement conflicted with the FOREIGN KEY constraint "FK_orders_users". ` +
+				`The conflict occurred in database "shop", table "dbo.users", column 'id'.`},
+			want: &dberr.Error{Kind: dberr.ForeignKeyViolation, Code: "547", Constraint: "FK_orders_users"},
+		},
+		{
+			name: "mssql check violation",
+			err:  mssqlError{Number: 547, Class: 16, Message: `The UPDATE statement conflicted with the CHECK constraint "positive_balance".`},
+			want: &dberr.Error{Kind: dberr.CheckViolation, Code: "547", Constraint: "positive_balance"},
+		},
+		{
+			name: "mssql not-null violation",
+			err:  mssqlError{Number: 515, Class: 16, Message: "Cannot insert the value NULL into column 'email', table 'shop.dbo.users'; column does not allow nulls. INSERT fails."},
+			want: &dberr.Error{Kind: dberr.NotNullViolation, Code: "515", Table: "shop.dbo.users", Column: "email"},
+		},
+		{
+			name: "mssql deadlock",
+			err:  mssqlError{Number: 1205, Class: 13},
+			want: &dberr.Error{Kind: dberr.Deadlock, Code: "1205"},
+		},
+		{
+			name: "mssql snapshot update conflict",
+			err:  mssqlError{Number: 3960, Class: 16},
+			want: &dberr.Error{Kind: dberr.SerializationFailure, Code: "3960"},
+		},
+		{
+			name: "mssql lock request timeout",
+			err:  mssqlError{Number: 1222, Class: 16, Message: "Lock request time out period exceeded."},
+			want: &dberr.Error{Kind: dberr.LockTimeout, Code: "1222"},
+		},
+		{
+			name: "mssql invalid object",
+			err:  mssqlError{Number: 208, Class: 16},
+		},
+		{
+			name: "bad connection",
+			err:  driver.ErrBadConn,
+			want: &dberr.Error{Kind: dberr.ConnectionLost},
+		},
+		{
+			name: "connection reset",
+			err:  &net.OpError{Op: "read", Err: syscall.ECONNRESET},
+			want: &dberr.Error{Kind: dberr.ConnectionLost},
+		},
+		{
+			name: "network timeout",
+			err:  timeoutError{},
+			want: &dberr.Error{Kind: dberr.ConnectionLost},
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("create user: %w", &pgError{Code: "23505"}),
+			want: &dberr.Error{Kind: dberr.UniqueViolation, Code: "23505"},
+		},
+		{
+			name: "joined",
+			err:  errors.Join(errors.New("business error"), &mysqlError{Number: 1213}),
+			want: &dberr.Error{Kind: dberr.Deadlock, Code: "1213"},
+		},
+		{
+			name: "transaction error",
+			err:  &txctx.TxError{Phase: txctx.PhaseBody, Err: fmt.Errorf("insert: %w", &pgError{Code: "40001"})},
+			want: &dberr.Error{Kind: dberr.SerializationFailure, Code: "40001"},
+		},
+		{
+			name: "context canceled",
+			err:  context.Canceled,
+		},
+		{
+			name: "context deadline exceeded",
+			err:  fmt.Errorf("query: %w", context.DeadlineExceeded),
+		},
+		{
+			name: "unknown error",
+			err:  errors.New("boom"),
+		},
+		{
+			name: "nil",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dberr.Classify(tt.err)
+			if tt.want == nil {
+				assert.Nil(t, got)
+				assert.Equal(t, dberr.Unknown, dberr.KindOf(tt.err))
+				return
+			}
+
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want.Kind, got.Kind)
+			assert.Equal(t, tt.want.Code, got.Code)
+			assert.Equal(t, tt.want.Constraint, got.Constraint)
+			assert.Equal(t, tt.want.Table, got.Table)
+			assert.Equal(t, tt.want.Column, got.Column)
+			assert.NotNil(t, got.Err)
+			assert.ErrorIs(t, got, got.Err)
+		})
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	tests := []struct {
+		kind      dberr.Kind
+		predicate func(error) bool
+		retryable bool
+	}{
+		{dberr.UniqueViolation, dberr.IsUniqueViolation, false},
+		{dberr.ForeignKeyViolation, dberr.IsForeignKeyViolation, false},
+		{dberr.NotNullViolation, dberr.IsNotNullViolation, false},
+		{dberr.CheckViolation, dberr.IsCheckViolation, false},
+		{dberr.Deadlock, dberr.IsDeadlock, true},
+		{dberr.SerializationFailure, dberr.IsSerializationFailure, true},
+		{dberr.LockTimeout, dberr.IsLockTimeout, true},
+		{dberr.ConnectionLost, dberr.IsConnectionLost, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &dberr.Error{Kind: tt.kind, Err: errors.New("driver error")})
+
+			assert.True(t, tt.predicate(err))
+			assert.False(t, tt.predicate(errors.New("other")))
+			assert.Equal(t, tt.retryable, dberr.IsRetryable(err))
+		})
+	}
+
+	assert.False(t, dberr.IsRetryable(nil))
+	assert.False(t, dberr.IsRetryable(context.DeadlineExceeded))
+	assert.Equal(t, "unknown", dberr.Unknown.String())
+}
+
+func TestClassify_ThroughTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := txctx.SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").
+		WillReturnError(&pgError{Code: "23505", ConstraintName: "users_email_key", TableName: "users"})
+	mock.ExpectRollback()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		_, err := session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO users (email) VALUES (?)", "john@example.com")
+		return fmt.Errorf("create user: %w", err)
+	})
+
+	assert.True(t, dberr.IsUniqueViolation(err))
+	assert.False(t, dberr.IsRetryable(err))
+	assert.Equal(t, "users_email_key", dberr.Classify(err).Constraint)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestError_Error(t *testing.T) {
+	err := dberr.Classify(&pgError{Code: "40P01", Message: "deadlock detected"})
+	assert.Equal(t, "deadlock: ERROR: deadlock detected (SQLSTATE 40P01)", err.Error())
+}
@@ -0,0 +1,65 @@
+package dberr
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+var (
+	mysqlDuplicateKey = regexp.MustCompile("for key '(?:[^'.]+\\.)?([^']+)'")
+	mysqlForeignKey   = regexp.MustCompile("`([^`]+)`, CONSTRAINT `([^`]+)` FOREIGN KEY \\(`([^`]+)`\\)")
+	mysqlColumn       = regexp.MustCompile("Column '([^']+)'")
+	mysqlCheck        = regexp.MustCompile("Check constraint '([^']+)'")
+)
+
+// classifyMySQL classifies the errors of go-sql-driver/mysql, which expose the error number
+// in a `Number` field. The objects involved in the error are parsed from the message.
+func classifyMySQL(err error) *Error {
+	if err.Error() == "invalid connection" {
+		return &Error{Kind: ConnectionLost, Err: err}
+	}
+	v, ok := structOf(err)
+	if !ok {
+		return nil
+	}
+	n, s := v.FieldByName("Number"), v.FieldByName("SQLState")
+	if !n.IsValid() || n.Kind() != reflect.Uint16 || !s.IsValid() {
+		return nil
+	}
+
+	number := n.Uint()
+	e := &Error{Code: strconv.FormatUint(number, 10), Err: err}
+	msg := stringField(v, "Message")
+	switch number {
+	case 1062, 1586:
+		e.Kind = UniqueViolation
+		if m := mysqlDuplicateKey.FindStringSubmatch(msg); m != nil {
+			e.Constraint = m[1]
+		}
+	case 1216, 1217, 1451, 1452:
+		e.Kind = ForeignKeyViolation
+		if m := mysqlForeignKey.FindStringSubmatch(msg); m != nil {
+			e.Table, e.Constraint, e.Column = m[1], m[2], m[3]
+		}
+	case 1048, 1364:
+		e.Kind = NotNullViolation
+		if m := mysqlColumn.FindStringSubmatch(msg); m != nil {
+			e.Column = m[1]
+		}
+	case 3819:
+		e.Kind = CheckViolation
+		if m := mysqlCheck.FindStringSubmatch(msg); m != nil {
+			e.Constraint = m[1]
+		}
+	case 1213:
+		e.Kind = Deadlock
+	case 1205, 3572:
+		e.Kind = LockTimeout
+	case 1053, 2006, 2013:
+		e.Kind = ConnectionLost
+	default:
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,62 @@
+package dberr
+
+import "reflect"
+
+// classifyPostgres classifies the errors of lib/pq and pgx, which expose the SQLSTATE
+// either with a `SQLState()` method or, for older lib/pq versions, a `Code` field.
+func classifyPostgres(err error) *Error {
+	v, ok := structOf(err)
+	if !ok {
+		return nil
+	}
+
+	var code string
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		code = e.SQLState()
+	} else if c, s := v.FieldByName("Code"), v.FieldByName("Severity"); c.IsValid() && c.Kind() == reflect.String && s.IsValid() {
+		code = c.String()
+	}
+	if len(code) != 5 {
+		return nil
+	}
+
+	kind := postgresKind(code)
+	if kind == Unknown {
+		return nil
+	}
+	return &Error{
+		Kind:       kind,
+		Code:       code,
+		Constraint: stringField(v, "ConstraintName", "Constraint"),
+		Table:      stringField(v, "TableName", "Table"),
+		Column:     stringField(v, "ColumnName", "Column"),
+		Err:        err,
+	}
+}
+
+// postgresKind maps a SQLSTATE to a kind.
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+func postgresKind(code string) Kind {
+	switch code {
+	case "23505":
+		return UniqueViolation
+	case "23503":
+		return ForeignKeyViolation
+	case "23502":
+		return NotNullViolation
+	case "23514":
+		return CheckViolation
+	case "40P01":
+		return Deadlock
+	case "40001":
+		return SerializationFailure
+	case "55P03":
+		return LockTimeout
+	case "57P01", "57P02", "57P03":
+		return ConnectionLost
+	}
+	if code[:2] == "08" {
+		return ConnectionLost
+	}
+	return Unknown
+}
@@ -0,0 +1,81 @@
+package dberr
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SQLite extended result codes.
+// See https://www.sqlite.org/rescode.html
+const (
+	sqliteBusy                 = 5
+	sqliteLocked               = 6
+	sqliteConstraintCheck      = 275
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintNotNull    = 1299
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// classifySQLite classifies the errors of mattn/go-sqlite3, which expose the extended
+// result code in an `ExtendedCode` field, and modernc.org/sqlite, which exposes it with
+// a `Code()` method. The objects involved in the error are parsed from the message.
+func classifySQLite(err error) *Error {
+	var code int64
+	if e, ok := err.(interface{ Code() int }); ok {
+		code = int64(e.Code())
+	} else if v, ok := structOf(err); ok {
+		c, x := v.FieldByName("Code"), v.FieldByName("ExtendedCode")
+		if !c.IsValid() || !x.IsValid() || x.Kind() != reflect.Int || c.Kind() != reflect.Int {
+			return nil
+		}
+		code = x.Int()
+	} else {
+		return nil
+	}
+
+	e := &Error{Code: strconv.FormatInt(code, 10), Err: err}
+	switch code {
+	case sqliteConstraintUnique, sqliteConstraintPrimaryKey:
+		e.Kind = UniqueViolation
+		e.Table, e.Column = sqliteColumn(err.Error())
+	case sqliteConstraintForeignKey:
+		e.Kind = ForeignKeyViolation
+	case sqliteConstraintNotNull:
+		e.Kind = NotNullViolation
+		e.Table, e.Column = sqliteColumn(err.Error())
+	case sqliteConstraintCheck:
+		e.Kind = CheckViolation
+		e.Constraint = sqliteDetail(err.Error())
+	default:
+		// The primary result code is held in the least significant byte.
+		switch code & 0xff {
+		case sqliteBusy, sqliteLocked:
+			e.Kind = LockTimeout
+		default:
+			return nil
+		}
+	}
+	return e
+}
+
+// sqliteDetail returns what follows "constraint failed: " in messages such as
+// "UNIQUE constraint failed: users.email", without the result code appended by some drivers.
+func sqliteDetail(msg string) string {
+	i := strings.LastIndex(msg, "constraint failed: ")
+	if i < 0 {
+		return ""
+	}
+	detail, _, _ := strings.Cut(msg[i+len("constraint failed: "):], " (")
+	return strings.TrimSpace(detail)
+}
+
+// sqliteColumn parses the table and column from messages such as
+// "UNIQUE constraint failed: users.email". Only the first column of composite
+// constraints is returned.
+func sqliteColumn(msg string) (table, column string) {
+	ref, _, _ := strings.Cut(sqliteDetail(msg), ",")
+	table, column, _ = strings.Cut(ref, ".")
+	return table, column
+}
@@ -0,0 +1,65 @@
+package dberr
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+var (
+	sqlserverKeyConstraint = regexp.MustCompile("constraint '([^']+)'")
+	sqlserverObject        = regexp.MustCompile("object '([^']+)'")
+	sqlserverConstraint    = regexp.MustCompile(`(FOREIGN KEY|CHECK) constraint "([^"]+)"`)
+	sqlserverColumn        = regexp.MustCompile("column '([^']+)', table '([^']+)'")
+)
+
+// classifySQLServer classifies the errors of microsoft/go-mssqldb, which expose the error
+// number in a `Number` field along with a severity `Class`. The objects involved in the error
+// are parsed from the message.
+func classifySQLServer(err error) *Error {
+	v, ok := structOf(err)
+	if !ok {
+		return nil
+	}
+	n, c := v.FieldByName("Number"), v.FieldByName("Class")
+	if !n.IsValid() || n.Kind() != reflect.Int32 || !c.IsValid() {
+		return nil
+	}
+
+	number := n.Int()
+	e := &Error{Code: strconv.FormatInt(number, 10), Err: err}
+	msg := stringField(v, "Message")
+	switch number {
+	case 2601, 2627:
+		e.Kind = UniqueViolation
+		if m := sqlserverKeyConstraint.FindStringSubmatch(msg); m != nil {
+			e.Constraint = m[1]
+		}
+		if m := sqlserverObject.FindStringSubmatch(msg); m != nil {
+			e.Table = m[1]
+		}
+	case 547:
+		m := sqlserverConstraint.FindStringSubmatch(msg)
+		if m == nil {
+			return nil
+		}
+		e.Kind, e.Constraint = CheckViolation, m[2]
+		if m[1] == "FOREIGN KEY" {
+			e.Kind = ForeignKeyViolation
+		}
+	case 515:
+		e.Kind = NotNullViolation
+		if m := sqlserverColumn.FindStringSubmatch(msg); m != nil {
+			e.Column, e.Table = m[1], m[2]
+		}
+	case 1205:
+		e.Kind = Deadlock
+	case 3960:
+		e.Kind = SerializationFailure
+	case 1222:
+		e.Kind = LockTimeout
+	default:
+		return nil
+	}
+	return e
+}
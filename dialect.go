@@ -0,0 +1,75 @@
+package txctx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour of a database, for the helpers generating SQL.
+type Dialect int
+
+const (
+	Postgres Dialect = iota + 1
+	MySQL
+	SQLite
+	SQLServer
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	case MySQL:
+		return "mysql"
+	case SQLite:
+		return "sqlite"
+	case SQLServer:
+		return "sqlserver"
+	}
+	return "unknown"
+}
+
+// DialectOf returns the dialect of the session, see `WithDialect()`. It defaults to Postgres,
+// also for the sessions not created with `SQL()`.
+func DialectOf(s Session) Dialect {
+	if s, ok := s.(SQLSession); ok && s.dialect != 0 {
+		return s.dialect
+	}
+	return Postgres
+}
+
+// Rebind replaces the `?` placeholders of the query with the placeholders of the dialect.
+// Question marks inside quoted literals and identifiers are left untouched.
+func (d Dialect) Rebind(query string) string {
+	var prefix string
+	switch d {
+	case Postgres:
+		prefix = "$"
+	case SQLServer:
+		prefix = "@p"
+	default:
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString(prefix)
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
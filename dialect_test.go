@@ -0,0 +1,47 @@
+package txctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialect_Rebind(t *testing.T) {
+	query := `SELECT id FROM users WHERE email = ? AND name <> '?' AND "col?" = ? LIMIT ?`
+
+	assert.Equal(t, `SELECT id FROM users WHERE email = $1 AND name <> '?' AND "col?" = $2 LIMIT $3`, Postgres.Rebind(query))
+	assert.Equal(t, query, MySQL.Rebind(query))
+	assert.Equal(t, query, SQLite.Rebind(query))
+	assert.Equal(t, `SELECT id FROM users WHERE email = @p1 AND name <> '?' AND "col?" = @p2 LIMIT @p3`, SQLServer.Rebind(query))
+}
+
+func TestDialect_String(t *testing.T) {
+	assert.Equal(t, "postgres", Postgres.String())
+	assert.Equal(t, "mysql", MySQL.String())
+	assert.Equal(t, "sqlite", SQLite.String())
+	assert.Equal(t, "sqlserver", SQLServer.String())
+	assert.Equal(t, "unknown", Dialect(0).String())
+}
+
+func TestDialectOf(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, Postgres, DialectOf(SQL(db, nil)))
+
+	session := SQL(db, nil, WithDialect(SQLServer))
+	assert.Equal(t, SQLServer, DialectOf(session))
+
+	// Transactions keep the dialect of their session.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, SQLServer, DialectOf(child))
+	require.NoError(t, child.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
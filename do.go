@@ -0,0 +1,50 @@
+package txctx
+
+import "context"
+
+// Do executes a transaction with the session, like `Session.Transaction()`, and returns the
+// value returned by the function once the transaction is committed. If the transaction fails,
+// the zero value is returned along with the error.
+//
+// The transaction is retried according to the retry policy of the session, if any, and the
+// value of the successful attempt is returned.
+func Do[T any](ctx context.Context, s Session, f func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		v, err := f(ctx)
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// Do2 is like `Do()` for functions returning two values.
+func Do2[T, U any](ctx context.Context, s Session, f func(ctx context.Context) (T, U, error)) (T, U, error) {
+	var (
+		first  T
+		second U
+	)
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		v, w, err := f(ctx)
+		if err != nil {
+			return err
+		}
+		first, second = v, w
+		return nil
+	})
+	if err != nil {
+		var (
+			zeroT T
+			zeroU U
+		)
+		return zeroT, zeroU, err
+	}
+	return first, second, nil
+}
@@ -0,0 +1,139 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	ID   int
+	Name string
+}
+
+func TestDo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	u, err := Do(context.Background(), session, func(ctx context.Context) (*user, error) {
+		u := &user{Name: "john"}
+		err := session.QueryPerformer(ctx).QueryRowContext(ctx, "INSERT INTO users (name) VALUES (?) RETURNING id", u.Name).Scan(&u.ID)
+		return u, err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &user{ID: 7, Name: "john"}, u)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_Failure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	commitErr := errors.New("could not serialize access")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(commitErr)
+
+	// The value returned by the function is dropped when the transaction fails
+	n, err := Do(context.Background(), session, func(ctx context.Context) (int, error) {
+		return 42, assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Zero(t, n)
+
+	n, err = Do(context.Background(), session, func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+	assert.ErrorIs(t, err, commitErr)
+	assert.Zero(t, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_Retry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithRetryPolicy(RetryConcurrentModifications(2)))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	attempts := 0
+	n, err := Do(context.Background(), session, func(ctx context.Context) (int, error) {
+		attempts++
+		if attempts == 1 {
+			return attempts, ErrConcurrentModification
+		}
+		return attempts, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_Panic(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	rolledBack := false
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = Do(context.Background(), SQL(db, nil), func(ctx context.Context) (int, error) {
+			require.NoError(t, AfterRollback(ctx, func(ctx context.Context) {
+				rolledBack = true
+			}))
+			panic("boom")
+		})
+	})
+	assert.True(t, rolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo2(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	u, created, err := Do2(context.Background(), session, func(ctx context.Context) (user, bool, error) {
+		return user{ID: 1, Name: "john"}, true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, user{ID: 1, Name: "john"}, u)
+	assert.True(t, created)
+
+	u, created, err = Do2(context.Background(), session, func(ctx context.Context) (user, bool, error) {
+		return user{ID: 2}, true, assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Zero(t, u)
+	assert.False(t, created)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,92 @@
+package txctx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Phase of a transaction's lifecycle in which an error occurred.
+type Phase int
+
+const (
+	// PhaseBegin is the start of the transaction.
+	PhaseBegin Phase = iota + 1
+	// PhaseBody is the execution of the function given to `Transaction()`.
+	PhaseBody
+	// PhaseCommit is the commit of the transaction.
+	PhaseCommit
+	// PhaseRollback is the rollback of the transaction.
+	PhaseRollback
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseBegin:
+		return "begin"
+	case PhaseBody:
+		return "body"
+	case PhaseCommit:
+		return "commit"
+	case PhaseRollback:
+		return "rollback"
+	}
+	return "unknown"
+}
+
+// TxError is returned when a transaction fails. It records the phase in which the
+// transaction failed and the error that caused it. If the transaction was rolled back
+// after the failure and the rollback failed as well, the rollback error is kept too.
+//
+// Both errors can be inspected with `errors.Is()` and `errors.As()`, as they would be
+// if they were combined with `errors.Join()`.
+type TxError struct {
+	Phase Phase
+	// Name of the transaction, set with `WithName()`.
+	Name string
+	// Duration elapsed between the start of the transaction and the failure.
+	Duration time.Duration
+	// Err is the error that caused the transaction to fail.
+	Err error
+	// RollbackErr is the error returned by the rollback that followed the failure, if any.
+	RollbackErr error
+	// BackendID is the transaction ID assigned by the database, see `WithBackendTxID()`.
+	BackendID string
+}
+
+func (e *TxError) Error() string {
+	var b strings.Builder
+	b.WriteString("txctx: transaction")
+	if e.Name != "" {
+		fmt.Fprintf(&b, " %q", e.Name)
+	}
+	fmt.Fprintf(&b, " failed in %s", e.Phase)
+	if e.Duration > 0 {
+		fmt.Fprintf(&b, " after %s", e.Duration)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	if e.RollbackErr != nil {
+		fmt.Fprintf(&b, " (rollback failed: %v)", e.RollbackErr)
+	}
+	return b.String()
+}
+
+// Unwrap returns the cause and the rollback error, if any.
+func (e *TxError) Unwrap() []error {
+	if e.RollbackErr == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.RollbackErr}
+}
+
+// error wraps a failure of the transaction into a *TxError.
+func (t *transaction) error(phase Phase, err, rollbackErr error) *TxError {
+	return &TxError{
+		Phase:       phase,
+		Name:        t.name,
+		Duration:    time.Since(t.started),
+		Err:         err,
+		RollbackErr: rollbackErr,
+		BackendID:   t.backendID,
+	}
+}
@@ -0,0 +1,161 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type notFoundError struct {
+	id int
+}
+
+func (e notFoundError) Error() string {
+	return "not found"
+}
+
+func TestTxError_Begin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	beginErr := errors.New("too many connections")
+
+	mock.ExpectBegin().WillReturnError(beginErr)
+
+	err = session.Transaction(WithName(context.Background(), "create-user"), func(ctx context.Context) error {
+		return nil
+	})
+
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseBegin, txErr.Phase)
+	assert.Equal(t, "create-user", txErr.Name)
+	assert.Equal(t, beginErr, txErr.Err)
+	assert.NoError(t, txErr.RollbackErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxError_Body(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return notFoundError{id: 42}
+	})
+
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseBody, txErr.Phase)
+	assert.NoError(t, txErr.RollbackErr)
+
+	var nf notFoundError
+	require.ErrorAs(t, err, &nf)
+	assert.Equal(t, 42, nf.id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxError_BodyAndRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	bodyErr := errors.New("insufficient funds")
+	rollbackErr := errors.New("broken pipe")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback().WillReturnError(rollbackErr)
+
+	err = session.Transaction(WithName(context.Background(), "transfer"), func(ctx context.Context) error {
+		return bodyErr
+	})
+
+	assert.ErrorIs(t, err, bodyErr)
+	assert.ErrorIs(t, err, rollbackErr)
+
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseBody, txErr.Phase)
+	assert.Equal(t, rollbackErr, txErr.RollbackErr)
+	assert.Contains(t, err.Error(), `transaction "transfer" failed in body`)
+	assert.Contains(t, err.Error(), "insufficient funds (rollback failed: broken pipe)")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxError_Commit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	commitErr := errors.New("serialization failure")
+
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(commitErr)
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseCommit, txErr.Phase)
+	assert.ErrorIs(t, err, commitErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxError_ManualRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	rollbackErr := errors.New("broken pipe")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback().WillReturnError(rollbackErr)
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	err = child.Rollback()
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseRollback, txErr.Phase)
+	assert.ErrorIs(t, err, rollbackErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTxError_Error(t *testing.T) {
+	err := &TxError{
+		Phase:    PhaseCommit,
+		Name:     "checkout",
+		Duration: 1500 * time.Millisecond,
+		Err:      errors.New("connection reset"),
+	}
+	assert.Equal(t, `txctx: transaction "checkout" failed in commit after 1.5s: connection reset`, err.Error())
+
+	err = &TxError{Phase: PhaseBegin, Err: errors.New("refused")}
+	assert.Equal(t, "txctx: transaction failed in begin: refused", err.Error())
+}
+
+func TestPhase_String(t *testing.T) {
+	assert.Equal(t, "begin", PhaseBegin.String())
+	assert.Equal(t, "body", PhaseBody.String())
+	assert.Equal(t, "commit", PhaseCommit.String())
+	assert.Equal(t, "rollback", PhaseRollback.String())
+	assert.Equal(t, "unknown", Phase(0).String())
+}
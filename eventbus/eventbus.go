@@ -0,0 +1,158 @@
+// Package eventbus collects the domain events raised during a transaction and dispatches them
+// once they are part of the transaction's outcome.
+//
+// Events raised with `Bus.Raise()` are buffered on the transaction in the context. In-transaction
+// handlers run right before the commit, in the same transaction, and can still make it fail.
+// Asynchronous handlers run after the commit, so they only ever see committed data. Rolling the
+// transaction back drops its events, and rolling back a savepoint created with `txctx.Savepoint()`
+// drops the events raised within it.
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Config of an event bus.
+type Config struct {
+	// OnError is called when an asynchronous handler fails. Defaults to a warning logged with slog.
+	OnError func(evt any, err error)
+}
+
+type handler func(ctx context.Context, evt any) error
+
+type queued struct {
+	ctx context.Context
+	evt any
+}
+
+// Bus dispatches domain events to their handlers.
+type Bus struct {
+	onError func(evt any, err error)
+
+	mu    sync.RWMutex
+	sync  []handler
+	async []handler
+
+	qmu     sync.Mutex
+	idle    *sync.Cond
+	queue   []queued
+	running bool
+}
+
+// New creates an event bus without handlers.
+func New(cfg Config) *Bus {
+	if cfg.OnError == nil {
+		cfg.OnError = logError
+	}
+	b := &Bus{onError: cfg.OnError}
+	b.idle = sync.NewCond(&b.qmu)
+	return b
+}
+
+// Handle registers an in-transaction handler for the events of type E, which may be an interface.
+// It runs before the commit of the transaction raising the event, in the same transaction.
+// If it fails, the transaction is rolled back.
+func Handle[E any](b *Bus, h func(ctx context.Context, evt E) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sync = append(b.sync, typed(h))
+}
+
+// HandleAsync registers an asynchronous handler for the events of type E, which may be an interface.
+// It runs in the background once the transaction raising the event is committed. Events are
+// dispatched one at a time, in the order their transactions were committed.
+func HandleAsync[E any](b *Bus, h func(ctx context.Context, evt E) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.async = append(b.async, typed(h))
+}
+
+func typed[E any](h func(ctx context.Context, evt E) error) handler {
+	return func(ctx context.Context, evt any) error {
+		if e, ok := evt.(E); ok {
+			return h(ctx, e)
+		}
+		return nil
+	}
+}
+
+// Raise buffers the event on the transaction in the context.
+// `txctx.ErrNoTransaction` is returned if the context holds no transaction.
+func (b *Bus) Raise(ctx context.Context, evt any) error {
+	err := txctx.BeforeCommit(ctx, func(ctx context.Context) error {
+		return b.dispatch(ctx, evt)
+	})
+	if err != nil {
+		return err
+	}
+	return txctx.AfterCommit(ctx, func(ctx context.Context) {
+		b.enqueue(ctx, evt)
+	})
+}
+
+// Wait blocks until the asynchronous handlers have processed the committed events.
+func (b *Bus) Wait() {
+	b.qmu.Lock()
+	defer b.qmu.Unlock()
+	for b.running {
+		b.idle.Wait()
+	}
+}
+
+// dispatch runs the in-transaction handlers.
+func (b *Bus) dispatch(ctx context.Context, evt any) error {
+	b.mu.RLock()
+	handlers := b.sync
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		if err := h(ctx, evt); err != nil {
+			return fmt.Errorf("eventbus: handler of %T failed: %w", evt, err)
+		}
+	}
+	return nil
+}
+
+// enqueue hands a committed event over to the asynchronous handlers.
+func (b *Bus) enqueue(ctx context.Context, evt any) {
+	b.qmu.Lock()
+	defer b.qmu.Unlock()
+	b.queue = append(b.queue, queued{ctx: ctx, evt: evt})
+	if !b.running {
+		b.running = true
+		go b.drain()
+	}
+}
+
+func (b *Bus) drain() {
+	for {
+		b.qmu.Lock()
+		if len(b.queue) == 0 {
+			b.running = false
+			b.idle.Broadcast()
+			b.qmu.Unlock()
+			return
+		}
+		q := b.queue[0]
+		b.queue = b.queue[1:]
+		b.qmu.Unlock()
+
+		b.mu.RLock()
+		handlers := b.async
+		b.mu.RUnlock()
+		for _, h := range handlers {
+			if err := h(q.ctx, q.evt); err != nil {
+				b.onError(q.evt, err)
+			}
+		}
+	}
+}
+
+func logError(evt any, err error) {
+	slog.Warn("eventbus: asynchronous handler failed", slog.String("event", fmt.Sprintf("%T", evt)), slog.Any("error", err))
+}
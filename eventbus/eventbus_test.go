@@ -0,0 +1,187 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+type event interface {
+	OrderID() int
+}
+
+type orderPlaced struct{ ID int }
+
+func (e orderPlaced) OrderID() int { return e.ID }
+
+type orderCancelled struct{ ID int }
+
+func (e orderCancelled) OrderID() int { return e.ID }
+
+// recorder records the events seen by the handlers.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(kind string, evt any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch evt.(type) {
+	case orderPlaced:
+		r.events = append(r.events, kind+" placed")
+	case orderCancelled:
+		r.events = append(r.events, kind+" cancelled")
+	}
+}
+
+func (r *recorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func newTestBus(t *testing.T) (txctx.Session, *Bus, *recorder, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	rec := &recorder{}
+	b := New(Config{})
+	Handle(b, func(ctx context.Context, evt event) error {
+		rec.record("sync", evt)
+		return nil
+	})
+	HandleAsync(b, func(ctx context.Context, evt event) error {
+		rec.record("async", evt)
+		return nil
+	})
+	return txctx.SQL(db, nil), b, rec, mock
+}
+
+func TestBus_Commit(t *testing.T) {
+	session, b, rec, mock := newTestBus(t)
+
+	Handle(b, func(ctx context.Context, evt orderPlaced) error {
+		_, err := session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO invoices (order_id) VALUES (?)", evt.ID)
+		return err
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO invoices").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		require.NoError(t, b.Raise(ctx, orderPlaced{ID: 1}))
+		require.NoError(t, b.Raise(ctx, orderCancelled{ID: 2}))
+		assert.Empty(t, rec.recorded())
+		return nil
+	})
+	require.NoError(t, err)
+
+	b.Wait()
+	assert.Equal(t, []string{"sync placed", "sync cancelled", "async placed", "async cancelled"}, rec.recorded())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBus_Rollback(t *testing.T) {
+	session, b, rec, mock := newTestBus(t)
+	bodyErr := errors.New("out of stock")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		require.NoError(t, b.Raise(ctx, orderPlaced{ID: 1}))
+		return bodyErr
+	})
+	assert.ErrorIs(t, err, bodyErr)
+
+	b.Wait()
+	assert.Empty(t, rec.recorded())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBus_Savepoint(t *testing.T) {
+	session, b, rec, mock := newTestBus(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		require.NoError(t, b.Raise(ctx, orderPlaced{ID: 1}))
+		err := txctx.Savepoint(ctx, func(ctx context.Context) error {
+			require.NoError(t, b.Raise(ctx, orderCancelled{ID: 1}))
+			return errors.New("cannot cancel")
+		})
+		assert.Error(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+
+	b.Wait()
+	assert.Equal(t, []string{"sync placed", "async placed"}, rec.recorded())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBus_HandlerError(t *testing.T) {
+	session, b, rec, mock := newTestBus(t)
+	handlerErr := errors.New("invoice failed")
+	Handle(b, func(ctx context.Context, evt orderPlaced) error {
+		return handlerErr
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		return b.Raise(ctx, orderPlaced{ID: 1})
+	})
+	assert.ErrorIs(t, err, handlerErr)
+
+	b.Wait()
+	assert.Equal(t, []string{"sync placed"}, rec.recorded())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBus_AsyncHandlerError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	handlerErr := errors.New("mail server down")
+	var failed []any
+	b := New(Config{OnError: func(evt any, err error) {
+		assert.ErrorIs(t, err, handlerErr)
+		failed = append(failed, evt)
+	}})
+	HandleAsync(b, func(ctx context.Context, evt orderPlaced) error {
+		return handlerErr
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err = txctx.SQL(db, nil).Transaction(context.Background(), func(ctx context.Context) error {
+		return b.Raise(ctx, orderPlaced{ID: 1})
+	})
+	require.NoError(t, err)
+
+	b.Wait()
+	assert.Equal(t, []any{orderPlaced{ID: 1}}, failed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBus_Raise_NoTransaction(t *testing.T) {
+	b := New(Config{})
+	assert.ErrorIs(t, b.Raise(context.Background(), orderPlaced{ID: 1}), txctx.ErrNoTransaction)
+}
@@ -0,0 +1,236 @@
+// Package eventstore stores event-sourced streams in a SQL database, Postgres or SQLite.
+//
+// Events are appended to their stream through the transaction in the context, so they are
+// committed along with the other writes of the use case. Appends check the version the caller
+// expects the stream to be at, and fail with a *ConcurrencyError if another writer got there first.
+//
+// Every event also gets a global position. Appends are serialized until their transaction
+// commits, so positions follow the commit order: readers going through the global log, such as
+// subscriptions, never see an event show up behind a position they already processed.
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/dberr"
+)
+
+const (
+	// AnyVersion disables the version check of an append.
+	AnyVersion int64 = -1
+
+	// NoStream expects the stream not to exist yet.
+	NoStream int64 = 0
+)
+
+// advisoryNamespace is the first key of the Postgres advisory locks serializing the appends,
+// so that they don't collide with the advisory locks of the application or of package lock.
+const advisoryNamespace = 0x74786576 // "txev"
+
+// ErrConcurrency is matched by every *ConcurrencyError.
+var ErrConcurrency = errors.New("eventstore: concurrency conflict")
+
+// ConcurrencyError is returned when appending to a stream that is not at the expected version.
+type ConcurrencyError struct {
+	StreamID string
+	Expected int64
+	// Actual is the version of the stream, or -1 if it is unknown.
+	Actual int64
+}
+
+func (e *ConcurrencyError) Error() string {
+	if e.Actual < 0 {
+		return fmt.Sprintf("eventstore: stream %q was modified concurrently, expected version %d", e.StreamID, e.Expected)
+	}
+	return fmt.Sprintf("eventstore: stream %q is at version %d, expected version %d", e.StreamID, e.Actual, e.Expected)
+}
+
+// Is makes the error match `ErrConcurrency`.
+func (e *ConcurrencyError) Is(target error) bool {
+	return target == ErrConcurrency
+}
+
+// EventData is an event to append.
+type EventData struct {
+	Type     string
+	Data     []byte
+	Metadata []byte
+}
+
+// Event is a stored event.
+type Event struct {
+	// Position of the event in the global log.
+	Position int64
+	StreamID string
+	// Version of the stream once the event is applied, starting at 1.
+	Version    int64
+	Type       string
+	Data       []byte
+	Metadata   []byte
+	RecordedAt time.Time
+}
+
+// Config of a store.
+type Config struct {
+	// Dialect of the database, Postgres or SQLite. Defaults to Postgres.
+	Dialect txctx.Dialect
+
+	// Table holding the events. Defaults to "events".
+	Table string
+
+	// SnapshotTable holding the snapshots. Defaults to "snapshots".
+	SnapshotTable string
+
+	// CheckpointTable holding the positions of the subscriptions. Defaults to "checkpoints".
+	CheckpointTable string
+
+	// BatchSize is the maximum number of events processed by a subscription in one transaction.
+	// Defaults to 100.
+	BatchSize int
+
+	// PollInterval is the interval between two polls of a subscription that caught up.
+	// Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Store of events.
+type Store struct {
+	session txctx.Session
+	cfg     Config
+	now     func() time.Time
+}
+
+// New creates a new store using the given session. An error is returned if the dialect is not supported.
+func New(session txctx.Session, cfg Config) (*Store, error) {
+	if cfg.Dialect == 0 {
+		cfg.Dialect = txctx.Postgres
+	}
+	if cfg.Dialect != txctx.Postgres && cfg.Dialect != txctx.SQLite {
+		return nil, fmt.Errorf("eventstore: unsupported dialect %s", cfg.Dialect)
+	}
+	if cfg.Table == "" {
+		cfg.Table = "events"
+	}
+	if cfg.SnapshotTable == "" {
+		cfg.SnapshotTable = "snapshots"
+	}
+	if cfg.CheckpointTable == "" {
+		cfg.CheckpointTable = "checkpoints"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	return &Store{
+		session: session,
+		cfg:     cfg,
+		now:     time.Now,
+	}, nil
+}
+
+// Append appends the events to the stream, provided it is at the expected version, and returns
+// the new version of the stream. Pass `NoStream` for a new stream and `AnyVersion` to skip the check.
+//
+// Append must be called in a transaction, usually the one of the use case producing the events,
+// or `txctx.ErrNoTransaction` is returned. Until it commits, the other appends wait, which keeps
+// the global positions in commit order.
+func (s *Store) Append(ctx context.Context, streamID string, expected int64, events ...EventData) (int64, error) {
+	if !txctx.IsInTransaction(ctx) {
+		return 0, txctx.ErrNoTransaction
+	}
+	p := s.session.QueryPerformer(ctx)
+	if s.cfg.Dialect == txctx.Postgres {
+		// SQLite serializes the writers already.
+		if _, err := p.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2))", advisoryNamespace, s.cfg.Table); err != nil {
+			return 0, err
+		}
+	}
+
+	var version int64
+	err := p.QueryRowContext(ctx, s.query("SELECT COALESCE(MAX(version), 0) FROM %s WHERE stream_id = ?", s.cfg.Table), streamID).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	if expected != AnyVersion && expected != version {
+		return 0, &ConcurrencyError{StreamID: streamID, Expected: expected, Actual: version}
+	}
+	if len(events) == 0 {
+		return version, nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (stream_id, version, type, data, metadata, recorded_at) VALUES ", s.cfg.Table)
+	args := make([]any, 0, 6*len(events))
+	now := s.now().UTC()
+	for i, e := range events {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(?, ?, ?, ?, ?, ?)")
+		args = append(args, streamID, version+int64(i)+1, e.Type, e.Data, e.Metadata, now)
+	}
+	if _, err := p.ExecContext(ctx, s.cfg.Dialect.Rebind(b.String()), args...); err != nil {
+		if dberr.IsUniqueViolation(err) {
+			return 0, &ConcurrencyError{StreamID: streamID, Expected: expected, Actual: -1}
+		}
+		return 0, err
+	}
+	return version + int64(len(events)), nil
+}
+
+// Version returns the version of the stream, 0 if it doesn't exist.
+func (s *Store) Version(ctx context.Context, streamID string) (int64, error) {
+	var version int64
+	err := s.session.QueryPerformer(ctx).QueryRowContext(ctx,
+		s.query("SELECT COALESCE(MAX(version), 0) FROM %s WHERE stream_id = ?", s.cfg.Table),
+		streamID,
+	).Scan(&version)
+	return version, err
+}
+
+// ReadStream returns the events of the stream after the given version, in order.
+// Pass 0 to read the whole stream, or the version of a snapshot to read the events following it.
+func (s *Store) ReadStream(ctx context.Context, streamID string, after int64) ([]Event, error) {
+	return s.read(ctx,
+		s.query("SELECT position, stream_id, version, type, data, metadata, recorded_at FROM %s WHERE stream_id = ? AND version > ? ORDER BY version", s.cfg.Table),
+		streamID, after,
+	)
+}
+
+// ReadAll returns at most limit events of all streams after the given global position, in order.
+func (s *Store) ReadAll(ctx context.Context, after int64, limit int) ([]Event, error) {
+	return s.read(ctx,
+		s.query("SELECT position, stream_id, version, type, data, metadata, recorded_at FROM %s WHERE position > ? ORDER BY position LIMIT ?", s.cfg.Table),
+		after, limit,
+	)
+}
+
+func (s *Store) read(ctx context.Context, query string, args ...any) ([]Event, error) {
+	rows, err := s.session.QueryPerformer(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.Position, &e.StreamID, &e.Version, &e.Type, &e.Data, &e.Metadata, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// query formats the query with the table name and rebinds its placeholders.
+func (s *Store) query(query, table string) string {
+	return s.cfg.Dialect.Rebind(fmt.Sprintf(query, table))
+}
@@ -0,0 +1,187 @@
+package eventstore
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+type uniqueViolation struct{}
+
+func (uniqueViolation) Error() string    { return "duplicate key value violates unique constraint" }
+func (uniqueViolation) SQLState() string { return "23505" }
+
+func newTestStore(t *testing.T, cfg Config) (*Store, sqlmock.Sqlmock) {
+	session, mock := txtest.Session(t)
+	s, err := New(session, cfg)
+	require.NoError(t, err)
+	s.now = txtest.Clock
+	return s, mock
+}
+
+func expectVersion(mock sqlmock.Sqlmock, streamID string, version int64) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM events WHERE stream_id = $1")).
+		WithArgs(streamID).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func eventRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"position", "stream_id", "version", "type", "data", "metadata", "recorded_at"})
+}
+
+func TestStore_Append(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, hashtext($2))")).WithArgs(advisoryNamespace, "events").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, "order-1", 2)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (stream_id, version, type, data, metadata, recorded_at) VALUES ($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12)")).
+		WithArgs(
+			"order-1", int64(3), "ItemAdded", []byte(`{"sku":"a"}`), []byte(nil), txtest.Now,
+			"order-1", int64(4), "OrderPlaced", []byte(`{}`), []byte(`{"user":"u1"}`), txtest.Now,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	var version int64
+	err := s.session.Transaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		version, err = s.Append(ctx, "order-1", 2,
+			EventData{Type: "ItemAdded", Data: []byte(`{"sku":"a"}`)},
+			EventData{Type: "OrderPlaced", Data: []byte(`{}`), Metadata: []byte(`{"user":"u1"}`)},
+		)
+		return err
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_Append_ConcurrencyError(t *testing.T) {
+	t.Run("unexpected version", func(t *testing.T) {
+		s, mock := newTestStore(t, Config{Dialect: txctx.SQLite})
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM events WHERE stream_id = ?")).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectRollback()
+
+		err := s.session.Transaction(context.Background(), func(ctx context.Context) error {
+			_, err := s.Append(ctx, "order-1", NoStream, EventData{Type: "OrderCreated"})
+			return err
+		})
+		assert.ErrorIs(t, err, ErrConcurrency)
+
+		var concurrencyErr *ConcurrencyError
+		require.ErrorAs(t, err, &concurrencyErr)
+		assert.Equal(t, &ConcurrencyError{StreamID: "order-1", Expected: 0, Actual: 3}, concurrencyErr)
+		assert.EqualError(t, concurrencyErr, `eventstore: stream "order-1" is at version 3, expected version 0`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unique violation", func(t *testing.T) {
+		s, mock := newTestStore(t, Config{Dialect: txctx.SQLite})
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(0))
+		mock.ExpectExec("INSERT INTO events").WillReturnError(uniqueViolation{})
+		mock.ExpectRollback()
+
+		err := s.session.Transaction(context.Background(), func(ctx context.Context) error {
+			_, err := s.Append(ctx, "order-1", NoStream, EventData{Type: "OrderCreated"})
+			return err
+		})
+		var concurrencyErr *ConcurrencyError
+		require.ErrorAs(t, err, &concurrencyErr)
+		assert.Equal(t, int64(-1), concurrencyErr.Actual)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStore_Append_AnyVersion(t *testing.T) {
+	s, mock := newTestStore(t, Config{Dialect: txctx.SQLite})
+
+	// SQLite serializes the appends without an advisory lock.
+	mock.ExpectBegin()
+	mock.ExpectQuery("^" + regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM events WHERE stream_id = ?") + "$").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(7))
+	mock.ExpectExec("^"+regexp.QuoteMeta("INSERT INTO events (stream_id, version, type, data, metadata, recorded_at) VALUES (?, ?, ?, ?, ?, ?)")+"$").
+		WithArgs("order-1", int64(8), "OrderShipped", []byte(nil), []byte(nil), txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var version int64
+	err := s.session.Transaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		version, err = s.Append(ctx, "order-1", AnyVersion, EventData{Type: "OrderShipped"})
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_Append_NoTransaction(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	_, err := s.Append(context.Background(), "order-1", NoStream, EventData{Type: "OrderCreated"})
+	assert.ErrorIs(t, err, txctx.ErrNoTransaction)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_ReadStream(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT position, stream_id, version, type, data, metadata, recorded_at FROM events WHERE stream_id = $1 AND version > $2 ORDER BY version")).
+		WithArgs("order-1", int64(1)).
+		WillReturnRows(eventRows().
+			AddRow(12, "order-1", 2, "ItemAdded", []byte(`{}`), nil, txtest.Now).
+			AddRow(15, "order-1", 3, "OrderPlaced", []byte(`{}`), []byte(`{}`), txtest.Now))
+
+	events, err := s.ReadStream(context.Background(), "order-1", 1)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, Event{Position: 12, StreamID: "order-1", Version: 2, Type: "ItemAdded", Data: []byte(`{}`), RecordedAt: txtest.Now}, events[0])
+	assert.Equal(t, int64(3), events[1].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_ReadAll(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT position, stream_id, version, type, data, metadata, recorded_at FROM events WHERE position > $1 ORDER BY position LIMIT $2")).
+		WithArgs(int64(10), 2).
+		WillReturnRows(eventRows().
+			AddRow(11, "order-1", 1, "OrderCreated", []byte(`{}`), nil, txtest.Now).
+			AddRow(12, "order-2", 1, "OrderCreated", []byte(`{}`), nil, txtest.Now))
+
+	events, err := s.ReadAll(context.Background(), 10, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "order-2", events[1].StreamID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_Version(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	expectVersion(mock, "order-1", 5)
+
+	version, err := s.Version(context.Background(), "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNew_UnsupportedDialect(t *testing.T) {
+	_, err := New(txctx.SQL(nil, nil), Config{Dialect: txctx.MySQL})
+	assert.EqualError(t, err, "eventstore: unsupported dialect mysql")
+}
@@ -0,0 +1,72 @@
+package eventstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Schema returns the statements creating the tables of events, snapshots and checkpoints
+// for the given dialect, Postgres or SQLite.
+func Schema(d txctx.Dialect, events, snapshots, checkpoints string) []string {
+	if d == txctx.SQLite {
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	position INTEGER PRIMARY KEY AUTOINCREMENT,
+	stream_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	data BLOB NOT NULL,
+	metadata BLOB,
+	recorded_at TIMESTAMP NOT NULL,
+	UNIQUE (stream_id, version)
+)`, events),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	stream_id TEXT NOT NULL PRIMARY KEY,
+	version INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	created_at TIMESTAMP NOT NULL
+)`, snapshots),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name TEXT NOT NULL PRIMARY KEY,
+	position INTEGER NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`, checkpoints),
+		}
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	position BIGSERIAL PRIMARY KEY,
+	stream_id VARCHAR(255) NOT NULL,
+	version BIGINT NOT NULL,
+	type VARCHAR(255) NOT NULL,
+	data BYTEA NOT NULL,
+	metadata BYTEA,
+	recorded_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (stream_id, version)
+)`, events),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	stream_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	version BIGINT NOT NULL,
+	data BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+)`, snapshots),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	position BIGINT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`, checkpoints),
+	}
+}
+
+// CreateTables creates the tables of events, snapshots and checkpoints if they don't exist.
+func (s *Store) CreateTables(ctx context.Context) error {
+	p := s.session.QueryPerformer(ctx)
+	for _, stmt := range Schema(s.cfg.Dialect, s.cfg.Table, s.cfg.SnapshotTable, s.cfg.CheckpointTable) {
+		if _, err := p.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package eventstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestSchema(t *testing.T) {
+	// Concurrent appends conflict on the version, and the upserts of the snapshots and
+	// checkpoints on their key.
+	tests := []struct {
+		dialect     txctx.Dialect
+		events      []string
+		snapshots   []string
+		checkpoints []string
+	}{
+		{
+			dialect:     txctx.Postgres,
+			events:      []string{"position BIGSERIAL PRIMARY KEY", "data BYTEA NOT NULL", "UNIQUE (stream_id, version)"},
+			snapshots:   []string{"stream_id VARCHAR(255) NOT NULL PRIMARY KEY", "created_at TIMESTAMPTZ NOT NULL"},
+			checkpoints: []string{"name VARCHAR(255) NOT NULL PRIMARY KEY", "position BIGINT NOT NULL"},
+		},
+		{
+			dialect:     txctx.SQLite,
+			events:      []string{"position INTEGER PRIMARY KEY AUTOINCREMENT", "data BLOB NOT NULL", "UNIQUE (stream_id, version)"},
+			snapshots:   []string{"stream_id TEXT NOT NULL PRIMARY KEY", "created_at TIMESTAMP NOT NULL"},
+			checkpoints: []string{"name TEXT NOT NULL PRIMARY KEY", "position INTEGER NOT NULL"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			stmts := Schema(tt.dialect, "events", "snapshots", "checkpoints")
+			require.Len(t, stmts, 3)
+			assert.Subset(t, txtest.Definitions(stmts[0]), tt.events)
+			assert.Subset(t, txtest.Definitions(stmts[1]), tt.snapshots)
+			assert.Subset(t, txtest.Definitions(stmts[2]), tt.checkpoints)
+		})
+	}
+}
+
+func TestStore_CreateTables(t *testing.T) {
+	s, mock := newTestStore(t, Config{Dialect: txctx.SQLite, Table: "log", SnapshotTable: "log_snapshots", CheckpointTable: "log_checkpoints"})
+	for _, table := range []string{"log", "log_snapshots", "log_checkpoints"} {
+		mock.ExpectExec(`(?s)^CREATE TABLE IF NOT EXISTS ` + table + ` \(.* TIMESTAMP NOT NULL.*\)$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	require.NoError(t, s.CreateTables(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,42 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Snapshot is the state of a stream at a given version.
+type Snapshot struct {
+	StreamID  string
+	Version   int64
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// SaveSnapshot saves the state of the stream at the given version, replacing the previous snapshot.
+func (s *Store) SaveSnapshot(ctx context.Context, streamID string, version int64, data []byte) error {
+	_, err := s.session.QueryPerformer(ctx).ExecContext(ctx,
+		s.query("INSERT INTO %s (stream_id, version, data, created_at) VALUES (?, ?, ?, ?) ON CONFLICT (stream_id) DO UPDATE SET version = excluded.version, data = excluded.data, created_at = excluded.created_at", s.cfg.SnapshotTable),
+		streamID, version, data, s.now().UTC(),
+	)
+	return err
+}
+
+// LoadSnapshot returns the latest snapshot of the stream. The boolean is false if the stream
+// has no snapshot. The events following the snapshot are read with `ReadStream()`.
+func (s *Store) LoadSnapshot(ctx context.Context, streamID string) (Snapshot, bool, error) {
+	snap := Snapshot{StreamID: streamID}
+	err := s.session.QueryPerformer(ctx).QueryRowContext(ctx,
+		s.query("SELECT version, data, created_at FROM %s WHERE stream_id = ?", s.cfg.SnapshotTable),
+		streamID,
+	).Scan(&snap.Version, &snap.Data, &snap.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Snapshot{}, false, nil
+	}
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	return snap, true, nil
+}
@@ -0,0 +1,45 @@
+package eventstore
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestStore_SaveSnapshot(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO snapshots (stream_id, version, data, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (stream_id) DO UPDATE SET version = excluded.version")).
+		WithArgs("order-1", int64(10), []byte(`{"total":100}`), txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveSnapshot(context.Background(), "order-1", 10, []byte(`{"total":100}`)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_LoadSnapshot(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, data, created_at FROM snapshots WHERE stream_id = $1")).
+		WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "data", "created_at"}).AddRow(10, []byte(`{"total":100}`), txtest.Now))
+	mock.ExpectQuery("SELECT version, data, created_at FROM snapshots").
+		WithArgs("order-2").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "data", "created_at"}))
+
+	snap, ok, err := s.LoadSnapshot(context.Background(), "order-1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Snapshot{StreamID: "order-1", Version: 10, Data: []byte(`{"total":100}`), CreatedAt: txtest.Now}, snap)
+
+	_, ok, err = s.LoadSnapshot(context.Background(), "order-2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,108 @@
+package eventstore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Subscription processes the events of all streams in order, for instance to build a projection.
+// Its position in the global log is checkpointed in the transaction processing the events, so
+// writes made by the handler through the transaction in the context are applied exactly once.
+type Subscription struct {
+	store   *Store
+	name    string
+	handler func(ctx context.Context, e Event) error
+}
+
+// Subscribe returns a subscription with the given name. The name identifies its checkpoint:
+// a subscription resumes where the previous one with the same name stopped.
+func (s *Store) Subscribe(name string, handler func(ctx context.Context, e Event) error) *Subscription {
+	return &Subscription{store: s, name: name, handler: handler}
+}
+
+// Poll processes the next batch of events in a transaction and returns the number of events processed.
+// If the handler fails, the transaction is rolled back and the batch is processed again by the next poll.
+// Concurrent polls of the same subscription wait for each other.
+func (sub *Subscription) Poll(ctx context.Context) (int, error) {
+	s := sub.store
+	n := 0
+	err := s.session.Transaction(ctx, func(ctx context.Context) error {
+		position, err := sub.checkpoint(ctx)
+		if err != nil {
+			return err
+		}
+		events, err := s.ReadAll(ctx, position, s.cfg.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		for _, e := range events {
+			if err := sub.handler(ctx, e); err != nil {
+				return err
+			}
+		}
+		_, err = s.session.QueryPerformer(ctx).ExecContext(ctx,
+			s.query("UPDATE %s SET position = ?, updated_at = ? WHERE name = ?", s.cfg.CheckpointTable),
+			events[len(events)-1].Position, s.now().UTC(), sub.name,
+		)
+		n = len(events)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Run polls until the context is canceled. Batches are processed back to back until the
+// subscription catches up, then it waits for the poll interval. Failures are logged with slog
+// and retried after the poll interval.
+func (sub *Subscription) Run(ctx context.Context) {
+	for {
+		n, err := sub.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("eventstore: subscription failed", slog.String("subscription", sub.name), slog.Any("error", err))
+		}
+		if err == nil && n == sub.store.cfg.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sub.store.cfg.PollInterval):
+		}
+	}
+}
+
+// Position returns the position of the last event processed by the subscription.
+func (sub *Subscription) Position(ctx context.Context) (int64, error) {
+	var position int64
+	err := sub.store.session.QueryPerformer(ctx).QueryRowContext(ctx,
+		sub.store.query("SELECT COALESCE(MAX(position), 0) FROM %s WHERE name = ?", sub.store.cfg.CheckpointTable),
+		sub.name,
+	).Scan(&position)
+	return position, err
+}
+
+// checkpoint returns the position of the subscription and locks it until the transaction ends.
+func (sub *Subscription) checkpoint(ctx context.Context) (int64, error) {
+	s := sub.store
+	p := s.session.QueryPerformer(ctx)
+	// Creating the checkpoint takes the write lock on SQLite.
+	_, err := p.ExecContext(ctx,
+		s.query("INSERT INTO %s (name, position, updated_at) VALUES (?, 0, ?) ON CONFLICT (name) DO NOTHING", s.cfg.CheckpointTable),
+		sub.name, s.now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	query := "SELECT position FROM %s WHERE name = ?"
+	if s.cfg.Dialect == txctx.Postgres {
+		query += " FOR UPDATE"
+	}
+	var position int64
+	err = p.QueryRowContext(ctx, s.query(query, s.cfg.CheckpointTable), sub.name).Scan(&position)
+	return position, err
+}
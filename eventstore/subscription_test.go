@@ -0,0 +1,110 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func expectCheckpoint(mock sqlmock.Sqlmock, position int64) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO checkpoints (name, position, updated_at) VALUES ($1, 0, $2) ON CONFLICT (name) DO NOTHING")).
+		WithArgs("orders", txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT position FROM checkpoints WHERE name = $1 FOR UPDATE")).
+		WithArgs("orders").
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(position))
+}
+
+func TestSubscription_Poll(t *testing.T) {
+	s, mock := newTestStore(t, Config{BatchSize: 2})
+	var handled []int64
+
+	sub := s.Subscribe("orders", func(ctx context.Context, e Event) error {
+		handled = append(handled, e.Position)
+		_, err := s.session.QueryPerformer(ctx).ExecContext(ctx, "UPDATE order_totals SET total = total + 1")
+		return err
+	})
+
+	mock.ExpectBegin()
+	expectCheckpoint(mock, 10)
+	mock.ExpectQuery("SELECT position, stream_id").
+		WithArgs(int64(10), 2).
+		WillReturnRows(eventRows().
+			AddRow(11, "order-1", 1, "OrderCreated", []byte(`{}`), nil, txtest.Now).
+			AddRow(12, "order-2", 1, "OrderCreated", []byte(`{}`), nil, txtest.Now))
+	mock.ExpectExec("UPDATE order_totals").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE order_totals").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE checkpoints SET position = $1, updated_at = $2 WHERE name = $3")).
+		WithArgs(int64(12), txtest.Now, "orders").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := sub.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{11, 12}, handled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscription_Poll_CaughtUp(t *testing.T) {
+	s, mock := newTestStore(t, Config{Dialect: txctx.SQLite})
+
+	sub := s.Subscribe("orders", func(ctx context.Context, e Event) error {
+		t.Fatal("no event to handle")
+		return nil
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO checkpoints (name, position, updated_at) VALUES (?, 0, ?) ON CONFLICT (name) DO NOTHING")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT position FROM checkpoints WHERE name = ?")).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(0))
+	mock.ExpectQuery("SELECT position, stream_id").WillReturnRows(eventRows())
+	mock.ExpectCommit()
+
+	n, err := sub.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscription_Poll_HandlerError(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+	handlerErr := errors.New("projection failed")
+
+	sub := s.Subscribe("orders", func(ctx context.Context, e Event) error {
+		return handlerErr
+	})
+
+	mock.ExpectBegin()
+	expectCheckpoint(mock, 10)
+	mock.ExpectQuery("SELECT position, stream_id").
+		WillReturnRows(eventRows().AddRow(11, "order-1", 1, "OrderCreated", []byte(`{}`), nil, txtest.Now))
+	mock.ExpectRollback()
+
+	n, err := sub.Poll(context.Background())
+	assert.ErrorIs(t, err, handlerErr)
+	assert.Zero(t, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscription_Position(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(position), 0) FROM checkpoints WHERE name = $1")).
+		WithArgs("orders").
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(42))
+
+	position, err := s.Subscribe("orders", nil).Position(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), position)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,173 @@
+package txctx
+
+import (
+	"context"
+	"sync"
+)
+
+// hookSet holds the functions registered on a transaction or on a savepoint.
+type hookSet struct {
+	beforeCommit  []func(context.Context) error
+	afterCommit   []func(context.Context)
+	afterRollback []func(context.Context)
+}
+
+// merge appends the functions of the other set, registered after the functions of this set.
+func (h *hookSet) merge(other hookSet) {
+	h.beforeCommit = append(h.beforeCommit, other.beforeCommit...)
+	h.afterCommit = append(h.afterCommit, other.afterCommit...)
+	h.afterRollback = append(h.afterRollback, other.afterRollback...)
+}
+
+// hooks holds the functions and values attached to a transaction.
+type hooks struct {
+	mu sync.Mutex
+	hookSet
+	values map[any]any
+	// onSavepoint are the functions called when a savepoint starts, see `OnSavepoint()`.
+	onSavepoint []func(context.Context)
+	// savepoints is the stack of the savepoints in progress, seq numbers their names.
+	savepoints []*savepoint
+	seq        int
+	done       bool
+}
+
+// current returns the transaction in the context, provided it is still active. Otherwise,
+// the error of its state is returned, such as `ErrAlreadyCommitted`.
+func current(ctx context.Context) (*transaction, error) {
+	t, _ := ctx.Value(transactionKey{}).(*transaction)
+	if t == nil {
+		return nil, ErrNoTransaction
+	}
+	if state := t.currentState(); state != StateActive {
+		return nil, stateError(state)
+	}
+	return t, nil
+}
+
+// register adds functions to the innermost savepoint in progress in the context,
+// or to the transaction itself.
+func register(ctx context.Context, add func(h *hookSet)) error {
+	t, err := current(ctx)
+	if err != nil {
+		return err
+	}
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	if sp := innermost(ctx, t); sp != nil {
+		add(&sp.hooks)
+	} else {
+		add(&t.hooks.hookSet)
+	}
+	return nil
+}
+
+// BeforeCommit registers a function called when the transaction in the context is committed,
+// before the commit is sent to the database. The function receives the transaction's context
+// and can still execute statements. If it returns an error, the transaction is rolled back
+// and the commit fails with a *TxError wrapping it.
+//
+// Functions are called in registration order, including the functions registered while
+// committing. `ErrNoTransaction` is returned if the context holds no transaction.
+func BeforeCommit(ctx context.Context, f func(ctx context.Context) error) error {
+	return register(ctx, func(h *hookSet) {
+		h.beforeCommit = append(h.beforeCommit, f)
+	})
+}
+
+// AfterCommit registers a function called once the transaction in the context is committed.
+// The function receives the context the transaction was started with, without its cancellation.
+// `ErrNoTransaction` is returned if the context holds no transaction.
+func AfterCommit(ctx context.Context, f func(ctx context.Context)) error {
+	return register(ctx, func(h *hookSet) {
+		h.afterCommit = append(h.afterCommit, f)
+	})
+}
+
+// AfterRollback registers a function called once the transaction in the context ends without
+// being committed: rolled back, aborted by the watchdog, or failed to commit. The function
+// receives the context the transaction was started with, without its cancellation.
+// `ErrNoTransaction` is returned if the context holds no transaction.
+//
+// Inside a savepoint, the function is also called if the savepoint is rolled back.
+func AfterRollback(ctx context.Context, f func(ctx context.Context)) error {
+	return register(ctx, func(h *hookSet) {
+		h.afterRollback = append(h.afterRollback, f)
+	})
+}
+
+// Attach returns the value attached to the transaction in the context under the given key.
+// On first use, the value returned by init is attached. Values are dropped when the
+// transaction ends. `ErrNoTransaction` is returned if the context holds no transaction.
+//
+// Values are not bound to the savepoint in progress: the functions serving them until the
+// transaction ends must be registered with `WithoutSavepoint()`.
+//
+// Like context keys, attachment keys should be of an unexported type to avoid collisions.
+func Attach(ctx context.Context, key any, init func() any) (any, error) {
+	t, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	if v, ok := t.hooks.values[key]; ok {
+		return v, nil
+	}
+	if t.hooks.values == nil {
+		t.hooks.values = make(map[any]any)
+	}
+	v := init()
+	t.hooks.values[key] = v
+	return v, nil
+}
+
+// flush calls the functions registered with `BeforeCommit()`. If one fails, the transaction
+// is rolled back.
+func (t *transaction) flush() error {
+	if t.currentState() != StateActive {
+		return nil
+	}
+	for i := 0; ; i++ {
+		t.hooks.mu.Lock()
+		if i >= len(t.hooks.beforeCommit) {
+			t.hooks.beforeCommit = nil
+			t.hooks.mu.Unlock()
+			return nil
+		}
+		f := t.hooks.beforeCommit[i]
+		t.hooks.mu.Unlock()
+
+		if err := f(t.ctx); err != nil {
+			return t.error(PhaseCommit, err, t.rollback())
+		}
+	}
+}
+
+// finish calls the functions registered for the outcome of the transaction, once it is done.
+func (t *transaction) finish() {
+	state := t.currentState()
+	t.hooks.mu.Lock()
+	if state == StateActive || t.hooks.done {
+		t.hooks.mu.Unlock()
+		return
+	}
+	var fs []func(context.Context)
+	if state == StateCommitted {
+		fs = t.hooks.afterCommit
+	} else {
+		// Savepoints still in progress are rolled back with the transaction, innermost first.
+		for i := len(t.hooks.savepoints) - 1; i >= 0; i-- {
+			fs = append(fs, t.hooks.savepoints[i].hooks.afterRollback...)
+		}
+		fs = append(fs, t.hooks.afterRollback...)
+	}
+	t.hooks.done = true
+	t.hooks.hookSet, t.hooks.values, t.hooks.onSavepoint, t.hooks.savepoints = hookSet{}, nil, nil, nil
+	t.hooks.mu.Unlock()
+
+	ctx := context.WithoutCancel(t.parent)
+	for _, f := range fs {
+		f(ctx)
+	}
+}
@@ -0,0 +1,185 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type hookKey struct{}
+
+func TestHooks_Commit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	var calls []string
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		require.NoError(t, BeforeCommit(ctx, func(ctx context.Context) error {
+			calls = append(calls, "before commit")
+			_, err := session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO audit (action) VALUES ('create')")
+			// Functions registered while committing are called as well
+			require.NoError(t, BeforeCommit(ctx, func(ctx context.Context) error {
+				calls = append(calls, "registered while committing")
+				_, err := session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO outbox (event) VALUES ('created')")
+				return err
+			}))
+			return err
+		}))
+		require.NoError(t, AfterCommit(ctx, func(ctx context.Context) {
+			assert.NoError(t, ctx.Err())
+			assert.Nil(t, ctx.Value(transactionKey{}))
+			calls = append(calls, "after commit")
+		}))
+		require.NoError(t, AfterRollback(ctx, func(ctx context.Context) {
+			calls = append(calls, "after rollback")
+		}))
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"before commit", "registered while committing", "after commit"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHooks_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	var calls []string
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+	ctx := child.Context()
+
+	require.NoError(t, BeforeCommit(ctx, func(ctx context.Context) error {
+		calls = append(calls, "before commit")
+		return nil
+	}))
+	require.NoError(t, AfterCommit(ctx, func(ctx context.Context) {
+		calls = append(calls, "after commit")
+	}))
+	require.NoError(t, AfterRollback(ctx, func(ctx context.Context) {
+		calls = append(calls, "after rollback")
+	}))
+
+	require.NoError(t, child.Rollback())
+	require.NoError(t, child.Rollback())
+	assert.Equal(t, []string{"after rollback"}, calls)
+
+	assert.ErrorIs(t, AfterCommit(ctx, func(ctx context.Context) {}), ErrAlreadyRolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHooks_BeforeCommitError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	flushErr := errors.New("flush failed")
+	rolledBack := false
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		require.NoError(t, BeforeCommit(ctx, func(ctx context.Context) error {
+			return flushErr
+		}))
+		require.NoError(t, AfterRollback(ctx, func(ctx context.Context) {
+			rolledBack = true
+		}))
+		return nil
+	})
+
+	assert.ErrorIs(t, err, flushErr)
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, PhaseCommit, txErr.Phase)
+	assert.True(t, rolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHooks_FailedCommit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	rolledBack := false
+
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("could not serialize access"))
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return AfterRollback(ctx, func(ctx context.Context) {
+			rolledBack = true
+		})
+	})
+
+	assert.Error(t, err)
+	assert.True(t, rolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHooks_NoTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	assert.ErrorIs(t, BeforeCommit(ctx, func(ctx context.Context) error { return nil }), ErrNoTransaction)
+	assert.ErrorIs(t, AfterCommit(ctx, func(ctx context.Context) {}), ErrNoTransaction)
+	assert.ErrorIs(t, AfterRollback(ctx, func(ctx context.Context) {}), ErrNoTransaction)
+
+	_, err := Attach(ctx, hookKey{}, func() any { return 1 })
+	assert.ErrorIs(t, err, ErrNoTransaction)
+}
+
+func TestAttach(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	inits := 0
+	init := func() any {
+		inits++
+		return &inits
+	}
+	for i := 0; i < 2; i++ {
+		err = session.Transaction(context.Background(), func(ctx context.Context) error {
+			v, err := Attach(ctx, hookKey{}, init)
+			require.NoError(t, err)
+			w, err := Attach(ctx, hookKey{}, init)
+			require.NoError(t, err)
+			assert.Same(t, v, w)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	// Each transaction gets its own value
+	assert.Equal(t, 2, inits)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
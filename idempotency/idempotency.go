@@ -0,0 +1,215 @@
+// Package idempotency runs transactions exactly once per idempotency key.
+//
+// The key is claimed inside the transaction, along with the business writes, and the
+// serialized result is stored in the same transaction. Replaying the request returns
+// the stored result without running the business function again. Concurrent requests
+// with the same key wait for the first one to complete, since the key row is locked
+// until its transaction commits or rolls back.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/dberr"
+)
+
+var (
+	// ErrInProgress is returned when a request with the same key is still being processed.
+	ErrInProgress = errors.New("idempotency: request in progress")
+
+	// ErrFingerprintMismatch is returned when a key is reused for a different request.
+	ErrFingerprintMismatch = errors.New("idempotency: key reused with a different request")
+)
+
+const (
+	statusInProgress = "in_progress"
+	statusCompleted  = "completed"
+)
+
+// Config of a store.
+type Config struct {
+	// Dialect of the database. Defaults to Postgres.
+	Dialect txctx.Dialect
+
+	// Table holding the keys. Defaults to "idempotency_keys".
+	Table string
+
+	// TTL is how long a key is remembered. A request replayed after the key expired
+	// is run again. Defaults to 24 hours.
+	TTL time.Duration
+}
+
+// Store of idempotency keys.
+type Store struct {
+	session txctx.Session
+	cfg     Config
+	now     func() time.Time
+}
+
+// New creates a new store running transactions with the given session.
+func New(session txctx.Session, cfg Config) *Store {
+	if cfg.Dialect == 0 {
+		cfg.Dialect = txctx.Postgres
+	}
+	if cfg.Table == "" {
+		cfg.Table = "idempotency_keys"
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	return &Store{
+		session: session,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// Fingerprint returns a fingerprint of the given request parts, such as the method,
+// path and body of an HTTP request.
+func Fingerprint(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d:", len(p))
+		h.Write(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Do runs f in a transaction, exactly once per key. The result of f is serialized as JSON
+// and stored with the key in the same transaction.
+//
+// If the key was already used by a completed request, the stored result is returned
+// without running f, and `replayed` is true. If the key was used for a request with a
+// different fingerprint, `ErrFingerprintMismatch` is returned.
+//
+// If f returns an error, the transaction is rolled back and the key is released: the
+// request will run again when replayed.
+func Do[T any](ctx context.Context, s *Store, key, fingerprint string, f func(context.Context) (T, error)) (result T, replayed bool, err error) {
+	err = s.session.Transaction(ctx, func(ctx context.Context) error {
+		stored, claimed, err := s.claim(ctx, key, fingerprint)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			replayed = true
+			return json.Unmarshal(stored, &result)
+		}
+
+		v, err := f(ctx)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("idempotency: cannot serialize result: %w", err)
+		}
+		if err := s.complete(ctx, key, data); err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	return result, replayed, nil
+}
+
+// claim inserts the key. If it already exists, its stored result is returned.
+func (s *Store) claim(ctx context.Context, key, fingerprint string) ([]byte, bool, error) {
+	p := s.session.QueryPerformer(ctx)
+
+	// The claim is attempted twice, in case the existing key expired or was pruned.
+	for range 2 {
+		now := s.now().UTC()
+		res, err := p.ExecContext(ctx, s.insertQuery(), key, fingerprint, statusInProgress, now, now.Add(s.cfg.TTL))
+		if dberr.IsLockTimeout(err) {
+			return nil, false, fmt.Errorf("%w: %s", ErrInProgress, key)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, false, err
+		}
+		if n == 1 {
+			return nil, true, nil
+		}
+
+		var storedFingerprint, status string
+		var stored []byte
+		var expiresAt time.Time
+		err = p.QueryRowContext(ctx, s.rebind("SELECT fingerprint, status, result, expires_at FROM %s WHERE idempotency_key = ?"), key).
+			Scan(&storedFingerprint, &status, &stored, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch {
+		case !now.Before(expiresAt):
+			if _, err := p.ExecContext(ctx, s.rebind("DELETE FROM %s WHERE idempotency_key = ?"), key); err != nil {
+				return nil, false, err
+			}
+			continue
+		case storedFingerprint != fingerprint:
+			return nil, false, fmt.Errorf("%w: %s", ErrFingerprintMismatch, key)
+		case status != statusCompleted:
+			return nil, false, fmt.Errorf("%w: %s", ErrInProgress, key)
+		}
+		return stored, false, nil
+	}
+	return nil, false, fmt.Errorf("%w: %s", ErrInProgress, key)
+}
+
+func (s *Store) complete(ctx context.Context, key string, result []byte) error {
+	_, err := s.session.QueryPerformer(ctx).ExecContext(ctx,
+		s.rebind("UPDATE %s SET status = ?, result = ? WHERE idempotency_key = ?"),
+		statusCompleted, result, key,
+	)
+	return err
+}
+
+// Prune deletes the expired keys and returns how many were deleted.
+func (s *Store) Prune(ctx context.Context) (int64, error) {
+	res, err := s.session.QueryPerformer(ctx).ExecContext(ctx,
+		s.rebind("DELETE FROM %s WHERE expires_at <= ?"),
+		s.now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// insertQuery returns the insert of a key, affecting no row if the key exists.
+//
+// On MySQL, INSERT IGNORE would also ignore the errors of invalid keys, such as a truncation:
+// the no-op update reports no row affected, unless the driver's clientFoundRows option is set.
+func (s *Store) insertQuery() string {
+	const columns = "(idempotency_key, fingerprint, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?)"
+	switch s.cfg.Dialect {
+	case txctx.MySQL:
+		return "INSERT INTO " + s.cfg.Table + " " + columns + " ON DUPLICATE KEY UPDATE idempotency_key = idempotency_key"
+	case txctx.SQLite:
+		return "INSERT OR IGNORE INTO " + s.cfg.Table + " " + columns
+	}
+	return s.cfg.Dialect.Rebind("INSERT INTO " + s.cfg.Table + " " + columns + " ON CONFLICT (idempotency_key) DO NOTHING")
+}
+
+// rebind formats the query with the table name and rebinds its placeholders.
+func (s *Store) rebind(query string) string {
+	return s.cfg.Dialect.Rebind(fmt.Sprintf(query, s.cfg.Table))
+}
@@ -0,0 +1,248 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+type receipt struct {
+	ChargeID string `json:"charge_id"`
+	Amount   int    `json:"amount"`
+}
+
+type lockError struct{}
+
+func (lockError) Error() string    { return "canceling statement due to lock timeout" }
+func (lockError) SQLState() string { return "55P03" }
+
+func newTestStore(t *testing.T, cfg Config) (*Store, sqlmock.Sqlmock) {
+	session, mock := txtest.Session(t)
+	s := New(session, cfg)
+	s.now = txtest.Clock
+	return s, mock
+}
+
+func expectClaim(mock sqlmock.Sqlmock, key, fingerprint string, claimed bool) {
+	var affected int64
+	if claimed {
+		affected = 1
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys (idempotency_key, fingerprint, status, created_at, expires_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (idempotency_key) DO NOTHING")).
+		WithArgs(key, fingerprint, statusInProgress, txtest.Now, txtest.Now.Add(24*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, affected))
+}
+
+func expectLookup(mock sqlmock.Sqlmock, key string, rows *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT fingerprint, status, result, expires_at FROM idempotency_keys WHERE idempotency_key = $1")).
+		WithArgs(key).
+		WillReturnRows(rows)
+}
+
+func keyRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"fingerprint", "status", "result", "expires_at"})
+}
+
+func TestDo_FirstRun(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectBegin()
+	expectClaim(mock, "key-1", "fp", true)
+	mock.ExpectExec("INSERT INTO charges").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE idempotency_keys SET status = $1, result = $2 WHERE idempotency_key = $3")).
+		WithArgs(statusCompleted, []byte(`{"charge_id":"ch_1","amount":100}`), "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, replayed, err := Do(context.Background(), s, "key-1", "fp", func(ctx context.Context) (receipt, error) {
+		_, err := s.session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO charges (amount) VALUES (?)", 100)
+		return receipt{ChargeID: "ch_1", Amount: 100}, err
+	})
+
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, receipt{ChargeID: "ch_1", Amount: 100}, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_Replay(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectBegin()
+	expectClaim(mock, "key-1", "fp", false)
+	expectLookup(mock, "key-1", keyRows().AddRow("fp", statusCompleted, []byte(`{"charge_id":"ch_1","amount":100}`), txtest.Now.Add(time.Hour)))
+	mock.ExpectCommit()
+
+	result, replayed, err := Do(context.Background(), s, "key-1", "fp", func(ctx context.Context) (receipt, error) {
+		t.Fatal("the function must not run again")
+		return receipt{}, nil
+	})
+
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, receipt{ChargeID: "ch_1", Amount: 100}, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_FingerprintMismatch(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectBegin()
+	expectClaim(mock, "key-1", "other", false)
+	expectLookup(mock, "key-1", keyRows().AddRow("fp", statusCompleted, []byte(`{}`), txtest.Now.Add(time.Hour)))
+	mock.ExpectRollback()
+
+	_, _, err := Do(context.Background(), s, "key-1", "other", func(ctx context.Context) (receipt, error) {
+		t.Fatal("the function must not run")
+		return receipt{}, nil
+	})
+
+	assert.ErrorIs(t, err, ErrFingerprintMismatch)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_InProgress(t *testing.T) {
+	t.Run("in progress status", func(t *testing.T) {
+		s, mock := newTestStore(t, Config{})
+
+		mock.ExpectBegin()
+		expectClaim(mock, "key-1", "fp", false)
+		expectLookup(mock, "key-1", keyRows().AddRow("fp", statusInProgress, nil, txtest.Now.Add(time.Hour)))
+		mock.ExpectRollback()
+
+		_, _, err := Do(context.Background(), s, "key-1", "fp", func(ctx context.Context) (int, error) {
+			return 0, nil
+		})
+		assert.ErrorIs(t, err, ErrInProgress)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("lock timeout", func(t *testing.T) {
+		s, mock := newTestStore(t, Config{})
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO idempotency_keys").WillReturnError(lockError{})
+		mock.ExpectRollback()
+
+		_, _, err := Do(context.Background(), s, "key-1", "fp", func(ctx context.Context) (int, error) {
+			return 0, nil
+		})
+		assert.ErrorIs(t, err, ErrInProgress)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDo_Expired(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectBegin()
+	expectClaim(mock, "key-1", "fp", false)
+	expectLookup(mock, "key-1", keyRows().AddRow("old", statusCompleted, []byte(`1`), txtest.Now.Add(-time.Minute)))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys WHERE idempotency_key = $1")).
+		WithArgs("key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectClaim(mock, "key-1", "fp", true)
+	mock.ExpectExec("UPDATE idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, replayed, err := Do(context.Background(), s, "key-1", "fp", func(ctx context.Context) (int, error) {
+		return 2, nil
+	})
+
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, 2, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_FunctionError(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+	businessErr := errors.New("card declined")
+
+	mock.ExpectBegin()
+	expectClaim(mock, "key-1", "fp", true)
+	mock.ExpectRollback()
+
+	result, replayed, err := Do(context.Background(), s, "key-1", "fp", func(ctx context.Context) (*receipt, error) {
+		return &receipt{}, businessErr
+	})
+
+	assert.ErrorIs(t, err, businessErr)
+	assert.Nil(t, result)
+	assert.False(t, replayed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDo_Dialects(t *testing.T) {
+	tests := []struct {
+		dialect txctx.Dialect
+		insert  string
+		update  string
+	}{
+		{
+			txctx.Postgres,
+			"INSERT INTO keys (idempotency_key, fingerprint, status, created_at, expires_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (idempotency_key) DO NOTHING",
+			"UPDATE keys SET status = $1, result = $2 WHERE idempotency_key = $3",
+		},
+		{
+			txctx.MySQL,
+			"INSERT INTO keys (idempotency_key, fingerprint, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE idempotency_key = idempotency_key",
+			"UPDATE keys SET status = ?, result = ? WHERE idempotency_key = ?",
+		},
+		{
+			txctx.SQLite,
+			"INSERT OR IGNORE INTO keys (idempotency_key, fingerprint, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+			"UPDATE keys SET status = ?, result = ? WHERE idempotency_key = ?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			s, mock := newTestStore(t, Config{Dialect: tt.dialect, Table: "keys", TTL: time.Hour})
+
+			mock.ExpectBegin()
+			mock.ExpectExec("^"+regexp.QuoteMeta(tt.insert)+"$").
+				WithArgs("key-1", "fp", statusInProgress, txtest.Now, txtest.Now.Add(time.Hour)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("^" + regexp.QuoteMeta(tt.update) + "$").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			_, _, err := Do(context.Background(), s, "key-1", "fp", func(ctx context.Context) (string, error) {
+				return "ok", nil
+			})
+			require.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	s, mock := newTestStore(t, Config{})
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys WHERE expires_at <= $1")).
+		WithArgs(txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := s.Prune(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint([]byte("POST"), []byte("/charges"), []byte(`{"amount":100}`))
+	assert.Len(t, a, 64)
+	assert.Equal(t, a, Fingerprint([]byte("POST"), []byte("/charges"), []byte(`{"amount":100}`)))
+	assert.NotEqual(t, a, Fingerprint([]byte("POST"), []byte("/charges"), []byte(`{"amount":200}`)))
+	assert.NotEqual(t, Fingerprint([]byte("ab"), []byte("c")), Fingerprint([]byte("a"), []byte("bc")))
+}
@@ -0,0 +1,58 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Schema returns the statements creating the table of idempotency keys for the given dialect.
+func Schema(d txctx.Dialect, table string) []string {
+	switch d {
+	case txctx.MySQL:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	idempotency_key VARCHAR(255) NOT NULL PRIMARY KEY,
+	fingerprint VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	result LONGBLOB,
+	created_at DATETIME(6) NOT NULL,
+	expires_at DATETIME(6) NOT NULL,
+	INDEX %[1]s_expires_at (expires_at)
+)`, table)}
+	case txctx.SQLite:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	idempotency_key TEXT NOT NULL PRIMARY KEY,
+	fingerprint TEXT NOT NULL,
+	status TEXT NOT NULL,
+	result BLOB,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+)`, table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_expires_at ON %[1]s (expires_at)", table),
+		}
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	idempotency_key VARCHAR(255) NOT NULL PRIMARY KEY,
+	fingerprint VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	result BYTEA,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+)`, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_expires_at ON %[1]s (expires_at)", table),
+	}
+}
+
+// CreateTable creates the table of idempotency keys if it doesn't exist.
+func (s *Store) CreateTable(ctx context.Context) error {
+	p := s.session.QueryPerformer(ctx)
+	for _, stmt := range Schema(s.cfg.Dialect, s.cfg.Table) {
+		if _, err := p.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
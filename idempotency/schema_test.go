@@ -0,0 +1,70 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestSchema(t *testing.T) {
+	tests := []struct {
+		dialect txctx.Dialect
+		defs    []string
+		indexes []string
+	}{
+		{
+			dialect: txctx.Postgres,
+			defs: []string{
+				"idempotency_key VARCHAR(255) NOT NULL PRIMARY KEY",
+				"result BYTEA",
+				"expires_at TIMESTAMPTZ NOT NULL",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS keys_expires_at ON keys (expires_at)"},
+		},
+		{
+			// MySQL has no CREATE INDEX IF NOT EXISTS, the index is declared with the table.
+			dialect: txctx.MySQL,
+			defs: []string{
+				"idempotency_key VARCHAR(255) NOT NULL PRIMARY KEY",
+				"result LONGBLOB",
+				"expires_at DATETIME(6) NOT NULL",
+				"INDEX keys_expires_at (expires_at)",
+			},
+		},
+		{
+			dialect: txctx.SQLite,
+			defs: []string{
+				"idempotency_key TEXT NOT NULL PRIMARY KEY",
+				"result BLOB",
+				"expires_at TIMESTAMP NOT NULL",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS keys_expires_at ON keys (expires_at)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			stmts := Schema(tt.dialect, "keys")
+			require.Len(t, stmts, 1+len(tt.indexes))
+			assert.Subset(t, txtest.Definitions(stmts[0]), tt.defs)
+			for i, index := range tt.indexes {
+				assert.Equal(t, index, stmts[1+i])
+			}
+		})
+	}
+}
+
+func TestStore_CreateTable(t *testing.T) {
+	s, mock := newTestStore(t, Config{Dialect: txctx.MySQL, Table: "idempotency"})
+	mock.ExpectExec(`(?s)^CREATE TABLE IF NOT EXISTS idempotency \(.*result LONGBLOB,.*INDEX idempotency_expires_at \(expires_at\)\s*\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, s.CreateTable(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
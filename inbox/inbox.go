@@ -0,0 +1,160 @@
+// Package inbox implements the inbox pattern to consume at-least-once deliveries
+// exactly once.
+//
+// The ID of every message is recorded in a deduplication table in the same transaction
+// as the handler's writes. A redelivered message finds its ID already recorded and is
+// skipped. Concurrent deliveries of the same message wait for the first one to complete,
+// since the recorded ID is locked until its transaction commits or rolls back.
+package inbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Handler processes a message of type M.
+type Handler[M any] func(ctx context.Context, msg M) error
+
+// Middleware decorates a handler. Broker clients plug handlers of their own message type
+// into an inbox with a middleware.
+type Middleware[M any] func(Handler[M]) Handler[M]
+
+// Config of an inbox.
+type Config struct {
+	// Dialect of the database. Defaults to Postgres.
+	Dialect txctx.Dialect
+
+	// Table holding the IDs of the processed messages. Defaults to "inbox_messages".
+	Table string
+
+	// Consumer is the name of the consumer. Several consumers can share the same table,
+	// each of them processing every message once.
+	Consumer string
+
+	// Retention is how long the IDs of processed messages are kept. Redeliveries happening
+	// after that are processed again. Defaults to 7 days.
+	Retention time.Duration
+
+	// PruneInterval is the interval between two prunings performed by `RunPruner()`.
+	// Defaults to one hour.
+	PruneInterval time.Duration
+
+	// OnDuplicate is called when a duplicate message is skipped.
+	OnDuplicate func(consumer, id string)
+}
+
+// Inbox deduplicates the messages processed by its handlers.
+type Inbox struct {
+	session txctx.Session
+	cfg     Config
+	now     func() time.Time
+}
+
+// New creates a new inbox running handlers in transactions of the given session.
+func New(session txctx.Session, cfg Config) *Inbox {
+	if cfg.Dialect == 0 {
+		cfg.Dialect = txctx.Postgres
+	}
+	if cfg.Table == "" {
+		cfg.Table = "inbox_messages"
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+	if cfg.PruneInterval <= 0 {
+		cfg.PruneInterval = time.Hour
+	}
+	return &Inbox{
+		session: session,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// Wrap returns a handler processing each message exactly once. The message ID is recorded
+// and the handler is run in the same transaction. Duplicates are skipped without error,
+// so that they are acknowledged by the broker.
+func Wrap[M any](in *Inbox, id func(M) string, h Handler[M]) Handler[M] {
+	return func(ctx context.Context, msg M) error {
+		msgID := id(msg)
+		return in.session.Transaction(ctx, func(ctx context.Context) error {
+			recorded, err := in.record(ctx, msgID)
+			if err != nil {
+				return err
+			}
+			if !recorded {
+				if in.cfg.OnDuplicate != nil {
+					in.cfg.OnDuplicate(in.cfg.Consumer, msgID)
+				}
+				return nil
+			}
+			return h(ctx, msg)
+		})
+	}
+}
+
+// Dedup returns a middleware wrapping handlers with `Wrap()`.
+func Dedup[M any](in *Inbox, id func(M) string) Middleware[M] {
+	return func(h Handler[M]) Handler[M] {
+		return Wrap(in, id, h)
+	}
+}
+
+// record inserts the message ID. It returns false if it was already recorded.
+func (in *Inbox) record(ctx context.Context, id string) (bool, error) {
+	res, err := in.session.QueryPerformer(ctx).ExecContext(ctx, in.insertQuery(), in.cfg.Consumer, id, in.now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Prune deletes the IDs of the messages processed before the retention period
+// and returns how many were deleted.
+func (in *Inbox) Prune(ctx context.Context) (int64, error) {
+	res, err := in.session.QueryPerformer(ctx).ExecContext(ctx,
+		in.cfg.Dialect.Rebind(fmt.Sprintf("DELETE FROM %s WHERE processed_at < ?", in.cfg.Table)),
+		in.now().UTC().Add(-in.cfg.Retention),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunPruner prunes the old entries periodically until the given context is done.
+// Failures are logged with slog and retried at the next interval.
+func (in *Inbox) RunPruner(ctx context.Context) {
+	ticker := time.NewTicker(in.cfg.PruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := in.Prune(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("inbox: pruning failed", slog.String("table", in.cfg.Table), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// insertQuery returns the insert of a message, affecting no row if it was already recorded.
+//
+// On MySQL, INSERT IGNORE would also ignore the errors of invalid IDs, such as a truncation:
+// the no-op update reports no row affected, unless the driver's clientFoundRows option is set.
+func (in *Inbox) insertQuery() string {
+	const columns = "(consumer, message_id, processed_at) VALUES (?, ?, ?)"
+	switch in.cfg.Dialect {
+	case txctx.MySQL:
+		return "INSERT INTO " + in.cfg.Table + " " + columns + " ON DUPLICATE KEY UPDATE message_id = message_id"
+	case txctx.SQLite:
+		return "INSERT OR IGNORE INTO " + in.cfg.Table + " " + columns
+	}
+	return in.cfg.Dialect.Rebind("INSERT INTO " + in.cfg.Table + " " + columns + " ON CONFLICT (consumer, message_id) DO NOTHING")
+}
@@ -0,0 +1,206 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+type orderPlaced struct {
+	ID      string
+	OrderID int
+}
+
+func messageID(m orderPlaced) string {
+	return m.ID
+}
+
+func newTestInbox(t *testing.T, cfg Config) (*Inbox, sqlmock.Sqlmock) {
+	session, mock := txtest.Session(t)
+	in := New(session, cfg)
+	in.now = txtest.Clock
+	return in, mock
+}
+
+func expectRecord(mock sqlmock.Sqlmock, id string, recorded bool) {
+	var affected int64
+	if recorded {
+		affected = 1
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO inbox_messages (consumer, message_id, processed_at) VALUES ($1, $2, $3) ON CONFLICT (consumer, message_id) DO NOTHING")).
+		WithArgs("billing", id, txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, affected))
+}
+
+func TestWrap_ProcessesOnce(t *testing.T) {
+	var duplicates []string
+	in, mock := newTestInbox(t, Config{
+		Consumer: "billing",
+		OnDuplicate: func(consumer, id string) {
+			duplicates = append(duplicates, consumer+"/"+id)
+		},
+	})
+
+	mock.ExpectBegin()
+	expectRecord(mock, "msg-1", true)
+	mock.ExpectExec("INSERT INTO invoices").WithArgs(42).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	expectRecord(mock, "msg-1", false)
+	mock.ExpectCommit()
+
+	var processed int
+	handler := Wrap(in, messageID, func(ctx context.Context, msg orderPlaced) error {
+		processed++
+		_, err := in.session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO invoices (order_id) VALUES (?)", msg.OrderID)
+		return err
+	})
+
+	msg := orderPlaced{ID: "msg-1", OrderID: 42}
+	require.NoError(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), msg))
+
+	assert.Equal(t, 1, processed)
+	assert.Equal(t, []string{"billing/msg-1"}, duplicates)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWrap_HandlerError(t *testing.T) {
+	in, mock := newTestInbox(t, Config{Consumer: "billing"})
+	handlerErr := errors.New("invoice service unavailable")
+
+	mock.ExpectBegin()
+	expectRecord(mock, "msg-1", true)
+	mock.ExpectRollback()
+
+	handler := Wrap(in, messageID, func(ctx context.Context, msg orderPlaced) error {
+		return handlerErr
+	})
+
+	err := handler(context.Background(), orderPlaced{ID: "msg-1"})
+	assert.ErrorIs(t, err, handlerErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWrap_RecordError(t *testing.T) {
+	in, mock := newTestInbox(t, Config{Consumer: "billing"})
+	dbErr := errors.New("relation inbox_messages does not exist")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO inbox_messages").WillReturnError(dbErr)
+	mock.ExpectRollback()
+
+	handler := Wrap(in, messageID, func(ctx context.Context, msg orderPlaced) error {
+		t.Fatal("the handler must not run")
+		return nil
+	})
+
+	assert.ErrorIs(t, handler(context.Background(), orderPlaced{ID: "msg-1"}), dbErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDedup(t *testing.T) {
+	in, mock := newTestInbox(t, Config{Consumer: "billing", Dialect: txctx.MySQL})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO inbox_messages (consumer, message_id, processed_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE message_id = message_id")).
+		WithArgs("billing", "msg-1", txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var calls []string
+	logging := func(h Handler[orderPlaced]) Handler[orderPlaced] {
+		return func(ctx context.Context, msg orderPlaced) error {
+			calls = append(calls, "log")
+			return h(ctx, msg)
+		}
+	}
+
+	middlewares := []Middleware[orderPlaced]{logging, Dedup(in, messageID)}
+	handler := Handler[orderPlaced](func(ctx context.Context, msg orderPlaced) error {
+		calls = append(calls, "handle")
+		return nil
+	})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	require.NoError(t, handler(context.Background(), orderPlaced{ID: "msg-1"}))
+	assert.Equal(t, []string{"log", "handle"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWrap_Dialects(t *testing.T) {
+	tests := []struct {
+		dialect txctx.Dialect
+		insert  string
+	}{
+		{txctx.Postgres, "INSERT INTO inbox (consumer, message_id, processed_at) VALUES ($1, $2, $3) ON CONFLICT (consumer, message_id) DO NOTHING"},
+		{txctx.MySQL, "INSERT INTO inbox (consumer, message_id, processed_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE message_id = message_id"},
+		{txctx.SQLite, "INSERT OR IGNORE INTO inbox (consumer, message_id, processed_at) VALUES (?, ?, ?)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			in, mock := newTestInbox(t, Config{Consumer: "billing", Dialect: tt.dialect, Table: "inbox"})
+
+			// A duplicate is reported by the insert affecting no row, whatever the dialect.
+			mock.ExpectBegin()
+			mock.ExpectExec("^"+regexp.QuoteMeta(tt.insert)+"$").
+				WithArgs("billing", "msg-1", txtest.Now).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			handler := Wrap(in, messageID, func(ctx context.Context, msg orderPlaced) error {
+				t.Error("duplicate message handled")
+				return nil
+			})
+			require.NoError(t, handler(context.Background(), orderPlaced{ID: "msg-1"}))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestInbox_Prune(t *testing.T) {
+	in, mock := newTestInbox(t, Config{Retention: time.Hour})
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM inbox_messages WHERE processed_at < $1")).
+		WithArgs(txtest.Now.Add(-time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	n, err := in.Prune(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInbox_RunPruner(t *testing.T) {
+	in, mock := newTestInbox(t, Config{PruneInterval: time.Millisecond})
+
+	stopped := make(chan struct{})
+	mock.ExpectExec("DELETE FROM inbox_messages").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		in.RunPruner(ctx)
+		close(stopped)
+	}()
+
+	require.Eventually(t, func() bool {
+		return mock.ExpectationsWereMet() == nil
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-stopped
+}
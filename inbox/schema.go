@@ -0,0 +1,52 @@
+package inbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Schema returns the statements creating the deduplication table for the given dialect.
+func Schema(d txctx.Dialect, table string) []string {
+	switch d {
+	case txctx.MySQL:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	consumer VARCHAR(255) NOT NULL,
+	message_id VARCHAR(255) NOT NULL,
+	processed_at DATETIME(6) NOT NULL,
+	PRIMARY KEY (consumer, message_id),
+	INDEX %[1]s_processed_at (processed_at)
+)`, table)}
+	case txctx.SQLite:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	consumer TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	processed_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (consumer, message_id)
+)`, table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_processed_at ON %[1]s (processed_at)", table),
+		}
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	consumer VARCHAR(255) NOT NULL,
+	message_id VARCHAR(255) NOT NULL,
+	processed_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (consumer, message_id)
+)`, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_processed_at ON %[1]s (processed_at)", table),
+	}
+}
+
+// CreateTable creates the deduplication table if it doesn't exist.
+func (in *Inbox) CreateTable(ctx context.Context) error {
+	p := in.session.QueryPerformer(ctx)
+	for _, stmt := range Schema(in.cfg.Dialect, in.cfg.Table) {
+		if _, err := p.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package inbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestSchema(t *testing.T) {
+	tests := []struct {
+		dialect txctx.Dialect
+		defs    []string
+		indexes []string
+	}{
+		{
+			dialect: txctx.Postgres,
+			defs: []string{
+				"message_id VARCHAR(255) NOT NULL",
+				"processed_at TIMESTAMPTZ NOT NULL",
+				"PRIMARY KEY (consumer, message_id)",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS inbox_processed_at ON inbox (processed_at)"},
+		},
+		{
+			// MySQL has no CREATE INDEX IF NOT EXISTS, the index is declared with the table.
+			dialect: txctx.MySQL,
+			defs: []string{
+				"message_id VARCHAR(255) NOT NULL",
+				"processed_at DATETIME(6) NOT NULL",
+				"PRIMARY KEY (consumer, message_id)",
+				"INDEX inbox_processed_at (processed_at)",
+			},
+		},
+		{
+			dialect: txctx.SQLite,
+			defs: []string{
+				"message_id TEXT NOT NULL",
+				"processed_at TIMESTAMP NOT NULL",
+				"PRIMARY KEY (consumer, message_id)",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS inbox_processed_at ON inbox (processed_at)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			stmts := Schema(tt.dialect, "inbox")
+			require.Len(t, stmts, 1+len(tt.indexes))
+			assert.Subset(t, txtest.Definitions(stmts[0]), tt.defs)
+			for i, index := range tt.indexes {
+				assert.Equal(t, index, stmts[1+i])
+			}
+		})
+	}
+}
+
+func TestInbox_CreateTable(t *testing.T) {
+	in, mock := newTestInbox(t, Config{Dialect: txctx.SQLite, Table: "received"})
+	mock.ExpectExec(`(?s)^CREATE TABLE IF NOT EXISTS received \(.*processed_at TIMESTAMP NOT NULL,.*\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^CREATE INDEX IF NOT EXISTS received_processed_at ON received \(processed_at\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, in.CreateTable(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,61 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+)
+
+// FromContext returns the SQL transaction in the context, if any.
+func FromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, _ := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, tx != nil
+}
+
+// IsInTransaction returns true if the context holds a transaction in progress, started by
+// a session or injected with `WithTx()`.
+func IsInTransaction(ctx context.Context) bool {
+	if t, _ := ctx.Value(transactionKey{}).(*transaction); t != nil {
+		return t.currentState() == StateActive
+	}
+	_, ok := FromContext(ctx)
+	return ok
+}
+
+// WithTx returns a copy of the context holding a SQL transaction owned by the caller, so that
+// code using `Session.QueryPerformer()` or the ambient functions runs in it. The caller remains
+// responsible for committing or rolling it back: the functions working on the transactions
+// started by a session, such as `BeforeCommit()` and `Savepoint()`, return `ErrNoTransaction`.
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(context.WithValue(ctx, txKey{}, tx), transactionKey{}, nil)
+}
+
+// WithoutTransaction returns a copy of the context without its transaction, keeping its values
+// and deadline. Statements executed with it run outside of the transaction, which is meant for
+// out-of-band writes such as audit logs, that must be kept even if the transaction rolls back.
+// Transactions started with it are not nested in the transaction.
+func WithoutTransaction(ctx context.Context) context.Context {
+	return context.WithValue(context.WithValue(ctx, txKey{}, nil), transactionKey{}, nil)
+}
+
+// NestingDepth returns the number of transactions the context is nested in: 0 outside of
+// a transaction, 1 in a transaction, 2 in a transaction started within a transaction, etc.
+// A transaction injected with `WithTx()` counts as one. Savepoints are not counted.
+func NestingDepth(ctx context.Context) int {
+	if t, _ := ctx.Value(transactionKey{}).(*transaction); t != nil {
+		return t.depth
+	}
+	if _, ok := FromContext(ctx); ok {
+		return 1
+	}
+	return 0
+}
+
+// TransactionID returns the ID of the transaction in the context, unique within the process,
+// for logging and correlation. It returns false if the context holds no transaction started
+// by a session. The ID assigned by the database can be captured with `WithBackendTxID()`.
+func TransactionID(ctx context.Context) (uint64, bool) {
+	if t, _ := ctx.Value(transactionKey{}).(*transaction); t != nil {
+		return t.serial, true
+	}
+	return 0, false
+}
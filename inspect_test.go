@@ -0,0 +1,114 @@
+package txctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	ctx := context.Background()
+
+	_, ok := FromContext(ctx)
+	assert.False(t, ok)
+	assert.False(t, IsInTransaction(ctx))
+	assert.Equal(t, 0, NestingDepth(ctx))
+	_, ok = TransactionID(ctx)
+	assert.False(t, ok)
+
+	mock.ExpectBegin()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectCommit()
+
+	var outerCtx context.Context
+	err = session.Transaction(ctx, func(ctx context.Context) error {
+		outerCtx = ctx
+		tx, ok := FromContext(ctx)
+		assert.True(t, ok)
+		assert.NotNil(t, tx)
+		assert.True(t, IsInTransaction(ctx))
+		assert.Equal(t, 1, NestingDepth(ctx))
+		outerID, ok := TransactionID(ctx)
+		assert.True(t, ok)
+
+		return session.Transaction(ctx, func(ctx context.Context) error {
+			assert.Equal(t, 2, NestingDepth(ctx))
+			innerID, _ := TransactionID(ctx)
+			assert.NotEqual(t, outerID, innerID)
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	assert.False(t, IsInTransaction(outerCtx))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	ctx := WithTx(context.Background(), tx)
+
+	got, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Same(t, tx, got)
+	assert.True(t, IsInTransaction(ctx))
+	assert.Equal(t, 1, NestingDepth(ctx))
+	_, ok = TransactionID(ctx)
+	assert.False(t, ok)
+
+	assert.Same(t, tx, session.QueryPerformer(ctx))
+	_, err = Exec(ctx, "INSERT INTO users (name) VALUES ('john')")
+	require.NoError(t, err)
+	assert.ErrorIs(t, BeforeCommit(ctx, func(ctx context.Context) error { return nil }), ErrNoTransaction)
+
+	require.NoError(t, tx.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithoutTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	type userKey struct{}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectRollback()
+
+	ctx := WithSession(context.WithValue(context.Background(), userKey{}, "john"), session)
+	err = InTransaction(ctx, func(ctx context.Context) error {
+		outside := WithoutTransaction(ctx)
+		assert.False(t, IsInTransaction(outside))
+		assert.Equal(t, 0, NestingDepth(outside))
+		assert.Equal(t, "john", outside.Value(userKey{}))
+		assert.Same(t, db, session.QueryPerformer(outside))
+
+		// The audit log is written on the database and survives the rollback
+		_, err := Exec(outside, "INSERT INTO audit (action) VALUES ('attempt')")
+		require.NoError(t, err)
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
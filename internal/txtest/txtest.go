@@ -0,0 +1,43 @@
+// Package txtest holds the fixtures shared by the tests of the txctx packages.
+package txtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Now is the current time of the components under test, see `Clock()`.
+var Now = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// Clock returns `Now`. It replaces the clock of the components under test.
+func Clock() time.Time {
+	return Now
+}
+
+// Session returns a session on a mock database, closed when the test ends.
+func Session(t testing.TB, options ...txctx.Option) (txctx.Session, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return txctx.SQL(db, nil, options...), mock
+}
+
+// Definitions returns the column and constraint definitions of a CREATE TABLE
+// statement written one per line, as the Schema functions write them.
+func Definitions(stmt string) []string {
+	lines := strings.Split(stmt, "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+	defs := make([]string, 0, len(lines)-2)
+	for _, line := range lines[1 : len(lines)-1] {
+		defs = append(defs, strings.TrimSuffix(strings.TrimSpace(line), ","))
+	}
+	return defs
+}
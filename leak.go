@@ -0,0 +1,266 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrOpenRows is returned by `Commit()` when result sets opened in the transaction
+// are still open. It is only detected by sessions with a leak detector.
+var ErrOpenRows = errors.New("txctx: rows still open in transaction")
+
+// LeakKind identifies the kind of resource left open.
+type LeakKind int
+
+const (
+	// LeakedSession is a child session that was neither committed nor rolled back.
+	LeakedSession LeakKind = iota + 1
+	// LeakedRows is a *sql.Rows that was not closed.
+	LeakedRows
+	// LeakedStmt is a *sql.Stmt that was not closed.
+	LeakedStmt
+)
+
+func (k LeakKind) String() string {
+	switch k {
+	case LeakedSession:
+		return "session"
+	case LeakedRows:
+		return "rows"
+	case LeakedStmt:
+		return "statement"
+	}
+	return "unknown"
+}
+
+// Leak describes a resource left open.
+type Leak struct {
+	Kind LeakKind
+	// Query is the query of the leaked rows or statement.
+	Query string
+	// Stack is the stack trace of the goroutine that created the resource.
+	Stack string
+}
+
+func (l Leak) String() string {
+	if l.Query == "" {
+		return fmt.Sprintf("%s left open, created at:\n%s", l.Kind, l.Stack)
+	}
+	return fmt.Sprintf("%s left open for query %q, created at:\n%s", l.Kind, l.Query, l.Stack)
+}
+
+// TestingT is the subset of testing.TB used by `VerifyNoLeaks()`.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// LeakDetector is a debug tool tracking the child sessions, rows and statements created
+// through the sessions it is attached to with `WithLeakDetector()`, along with their
+// creation stack.
+//
+// Leaks are reported to the callback when a child session is garbage-collected before
+// being committed or rolled back, and when a transaction is rolled back with rows still
+// open. `Leaks()` and `VerifyNoLeaks()` report every resource still open.
+//
+// Tracking has a noticeable cost and is not meant to be enabled in production.
+type LeakDetector struct {
+	onLeak func(Leak)
+
+	mu      sync.Mutex
+	seq     uint64
+	entries map[uint64]*leakEntry
+	pruneAt int
+}
+
+type leakEntry struct {
+	id   uint64
+	leak Leak
+	// owner is the id of the session entry the resource belongs to, zero outside transactions.
+	owner uint64
+	// closed reports whether the rows or statement were closed. Nil for sessions.
+	closed func() bool
+}
+
+const minPruneAt = 64
+
+// NewLeakDetector creates a leak detector reporting leaks to the given callback.
+// If the callback is nil, leaks are logged with slog.
+func NewLeakDetector(onLeak func(Leak)) *LeakDetector {
+	if onLeak == nil {
+		onLeak = func(l Leak) {
+			slog.Warn("txctx: " + l.String())
+		}
+	}
+	return &LeakDetector{
+		onLeak:  onLeak,
+		entries: make(map[uint64]*leakEntry),
+		pruneAt: minPruneAt,
+	}
+}
+
+// WithLeakDetector attaches a leak detector to the session.
+func WithLeakDetector(d *LeakDetector) Option {
+	return func(s *SQLSession) {
+		s.leaks = d
+	}
+}
+
+// Leaks returns the resources still open, in creation order.
+func (d *LeakDetector) Leaks() []Leak {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pruneLocked()
+	entries := make([]*leakEntry, 0, len(d.entries))
+	for _, e := range d.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+
+	leaks := make([]Leak, len(entries))
+	for i, e := range entries {
+		leaks[i] = e.leak
+	}
+	return leaks
+}
+
+// VerifyNoLeaks fails the test if any resource tracked by the detector is still open.
+// It is meant to be deferred at the beginning of a test.
+func (d *LeakDetector) VerifyNoLeaks(t TestingT) {
+	t.Helper()
+	for _, l := range d.Leaks() {
+		t.Errorf("txctx: %s", l)
+	}
+}
+
+func (d *LeakDetector) trackSession(t *transaction) {
+	e := d.track(Leak{Kind: LeakedSession, Stack: string(debug.Stack())}, 0, nil)
+	t.leaks = d
+	t.leakID = e.id
+	runtime.AddCleanup(t, d.collected, e.id)
+}
+
+func (d *LeakDetector) track(l Leak, owner uint64, closed func() bool) *leakEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.entries) >= d.pruneAt {
+		d.pruneLocked()
+		d.pruneAt = max(minPruneAt, 2*len(d.entries))
+	}
+	d.seq++
+	e := &leakEntry{id: d.seq, leak: l, owner: owner, closed: closed}
+	d.entries[e.id] = e
+	return e
+}
+
+// pruneLocked forgets the rows and statements that were closed.
+func (d *LeakDetector) pruneLocked() {
+	for id, e := range d.entries {
+		if e.closed != nil && e.closed() {
+			delete(d.entries, id)
+		}
+	}
+}
+
+// collected is called when a child session is garbage-collected.
+func (d *LeakDetector) collected(id uint64) {
+	d.mu.Lock()
+	e, ok := d.entries[id]
+	delete(d.entries, id)
+	d.mu.Unlock()
+
+	if ok {
+		d.onLeak(e.leak)
+	}
+}
+
+// openRows returns the rows still open in the given transaction.
+func (d *LeakDetector) openRows(t *transaction) []Leak {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var leaks []Leak
+	for _, e := range d.entries {
+		if e.owner == t.leakID && e.leak.Kind == LeakedRows && !e.closed() {
+			leaks = append(leaks, e.leak)
+		}
+	}
+	return leaks
+}
+
+// release forgets the session and the resources belonging to its transaction,
+// which are closed by database/sql once the transaction is done.
+func (d *LeakDetector) release(t *transaction) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.entries, t.leakID)
+	for id, e := range d.entries {
+		if e.owner == t.leakID {
+			delete(d.entries, id)
+		}
+	}
+}
+
+func openRowsError(leaks []Leak) error {
+	msgs := make([]string, len(leaks))
+	for i, l := range leaks {
+		msgs[i] = l.String()
+	}
+	return fmt.Errorf("%w: %s", ErrOpenRows, strings.Join(msgs, "\n"))
+}
+
+func rowsClosed(rows *sql.Rows) bool {
+	_, err := rows.Columns()
+	return err != nil
+}
+
+// stmtClosed probes a statement with a canceled context: database/sql checks whether
+// the statement is closed before the context, so the query never reaches the driver.
+func stmtClosed(stmt *sql.Stmt) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rows, err := stmt.QueryContext(ctx)
+	if err == nil {
+		_ = rows.Close()
+		return false
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+// leakPerformer tracks the rows and statements created through a performer.
+type leakPerformer struct {
+	Performer
+	leaks *LeakDetector
+	owner uint64
+}
+
+func (p leakPerformer) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := p.Performer.QueryContext(ctx, query, args...)
+	if err == nil {
+		l := Leak{Kind: LeakedRows, Query: query, Stack: string(debug.Stack())}
+		p.leaks.track(l, p.owner, func() bool { return rowsClosed(rows) })
+	}
+	return rows, err
+}
+
+func (p leakPerformer) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := p.Performer.PrepareContext(ctx, query)
+	if err == nil {
+		l := Leak{Kind: LeakedStmt, Query: query, Stack: string(debug.Stack())}
+		p.leaks.track(l, p.owner, func() bool { return stmtClosed(stmt) })
+	}
+	return stmt, err
+}
@@ -0,0 +1,226 @@
+package txctx
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+type leakRecorder struct {
+	mu    sync.Mutex
+	leaks []Leak
+}
+
+func (r *leakRecorder) record(l Leak) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.leaks = append(r.leaks, l)
+}
+
+func (r *leakRecorder) get() []Leak {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Leak(nil), r.leaks...)
+}
+
+func TestLeakDetector_NoLeaks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	detector := NewLeakDetector(nil)
+	session := SQL(db, nil, WithLeakDetector(detector))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectPrepare("INSERT INTO users")
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		performer := session.QueryPerformer(ctx)
+		rows, err := performer.QueryContext(ctx, "SELECT id FROM users")
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		// Statements prepared in a transaction are closed with it.
+		_, err = performer.PrepareContext(ctx, "INSERT INTO users (email) VALUES (?)")
+		return err
+	})
+	require.NoError(t, err)
+
+	rec := &recordingT{}
+	detector.VerifyNoLeaks(rec)
+	assert.Empty(t, rec.errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakDetector_OpenSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	detector := NewLeakDetector(nil)
+	session := SQL(db, nil, WithLeakDetector(detector))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	leaks := detector.Leaks()
+	require.Len(t, leaks, 1)
+	assert.Equal(t, LeakedSession, leaks[0].Kind)
+	assert.Contains(t, leaks[0].Stack, "TestLeakDetector_OpenSession")
+
+	rec := &recordingT{}
+	detector.VerifyNoLeaks(rec)
+	require.Len(t, rec.errors, 1)
+	assert.Contains(t, rec.errors[0], "session left open")
+
+	require.NoError(t, child.Rollback())
+	assert.Empty(t, detector.Leaks())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakDetector_OpenPoolResources(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	detector := NewLeakDetector(nil)
+	session := SQL(db, nil, WithLeakDetector(detector))
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectPrepare("DELETE FROM users").WillBeClosed()
+
+	performer := session.QueryPerformer(ctx)
+	rows, err := performer.QueryContext(ctx, "SELECT id FROM users")
+	require.NoError(t, err)
+	stmt, err := performer.PrepareContext(ctx, "DELETE FROM users WHERE id = ?")
+	require.NoError(t, err)
+
+	leaks := detector.Leaks()
+	require.Len(t, leaks, 2)
+	assert.Equal(t, LeakedRows, leaks[0].Kind)
+	assert.Equal(t, "SELECT id FROM users", leaks[0].Query)
+	assert.Equal(t, LeakedStmt, leaks[1].Kind)
+	assert.Equal(t, "DELETE FROM users WHERE id = ?", leaks[1].Query)
+
+	require.NoError(t, rows.Close())
+	require.NoError(t, stmt.Close())
+	assert.Empty(t, detector.Leaks())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakDetector_CommitWithOpenRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	detector := NewLeakDetector(nil)
+	session := SQL(db, nil, WithLeakDetector(detector))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	ctx := child.Context()
+	rows, err := child.QueryPerformer(ctx).QueryContext(ctx, "SELECT id FROM users")
+	require.NoError(t, err)
+
+	err = child.Commit()
+	assert.ErrorIs(t, err, ErrOpenRows)
+	assert.Contains(t, err.Error(), "SELECT id FROM users")
+	assert.Contains(t, err.Error(), "TestLeakDetector_CommitWithOpenRows")
+
+	// The transaction is untouched and can be committed once the rows are closed.
+	require.NoError(t, rows.Close())
+	assert.NoError(t, child.Commit())
+	assert.Empty(t, detector.Leaks())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakDetector_TransactionWithOpenRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rec := &leakRecorder{}
+	detector := NewLeakDetector(rec.record)
+	session := SQL(db, nil, WithLeakDetector(detector))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectRollback()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		_, err := session.QueryPerformer(ctx).QueryContext(ctx, "SELECT id FROM users")
+		return err
+	})
+
+	assert.ErrorIs(t, err, ErrOpenRows)
+	leaks := rec.get()
+	require.Len(t, leaks, 1)
+	assert.Equal(t, LeakedRows, leaks[0].Kind)
+	assert.Empty(t, detector.Leaks())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakDetector_GarbageCollectedSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rec := &leakRecorder{}
+	detector := NewLeakDetector(rec.record)
+	session := SQL(db, nil, WithLeakDetector(detector))
+
+	mock.ExpectBegin()
+
+	func() {
+		_, err := session.Begin(context.Background())
+		require.NoError(t, err)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.get()) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	leaks := rec.get()
+	require.Len(t, leaks, 1)
+	assert.Equal(t, LeakedSession, leaks[0].Kind)
+	assert.Empty(t, detector.Leaks())
+}
+
+func TestLeakKind_String(t *testing.T) {
+	assert.Equal(t, "session", LeakedSession.String())
+	assert.Equal(t, "rows", LeakedRows.String())
+	assert.Equal(t, "statement", LeakedStmt.String())
+	assert.Equal(t, "unknown", LeakKind(0).String())
+}
@@ -0,0 +1,119 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Lead campaigns for the leadership of the given name among the instances calling `Lead()` with
+// the same name, until the context is canceled. Failures are logged with slog.
+//
+// Once elected, f runs with a context canceled when the leadership is lost, that is when the
+// lease could not be renewed in time. When f returns, the leadership is released and the
+// instance campaigns again. The clocks of the instances are expected to be synchronized.
+func (l *Locker) Lead(ctx context.Context, name string, f func(ctx context.Context)) {
+	for {
+		elected, err := l.campaign(ctx, name)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("lock: campaign failed", slog.String("name", name), slog.Any("error", err))
+		}
+		if elected {
+			l.lead(ctx, name, f)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.cfg.LeaseTTL / 3):
+		}
+	}
+}
+
+// lead runs f while renewing the lease, then releases it.
+func (l *Locker) lead(ctx context.Context, name string, f func(ctx context.Context)) {
+	termCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(termCtx)
+	}()
+
+	ticker := time.NewTicker(l.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+	for leading := true; leading; {
+		select {
+		case <-done:
+			leading = false
+		case <-ctx.Done():
+			leading = false
+		case <-ticker.C:
+			renewed, err := l.campaign(ctx, name)
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("lock: lease renewal failed", slog.String("name", name), slog.Any("error", err))
+			}
+			leading = renewed
+		}
+	}
+	cancel()
+	<-done
+
+	if err := l.resign(context.WithoutCancel(ctx), name); err != nil {
+		slog.Warn("lock: resignation failed", slog.String("name", name), slog.Any("error", err))
+	}
+}
+
+// campaign takes or renews the lease of the leadership, unless another instance holds it.
+// Campaigns are serialized by the named lock, and bounded by a third of the lease TTL,
+// so that a leader failing to renew its lease steps down before it expires.
+func (l *Locker) campaign(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.LeaseTTL/3)
+	defer cancel()
+
+	elected := false
+	err := l.session.Transaction(ctx, func(ctx context.Context) error {
+		if err := l.Lock(ctx, name); err != nil {
+			return err
+		}
+		now := l.now().UTC()
+		p := l.session.QueryPerformer(ctx)
+		var holder string
+		var expiresAt sql.NullTime
+		err := p.QueryRowContext(ctx, l.query("SELECT holder, expires_at FROM %s WHERE name = ?"), name).Scan(&holder, &expiresAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if holder != "" && holder != l.cfg.Holder && expiresAt.Valid && expiresAt.Time.After(now) {
+			return nil
+		}
+		if _, err := p.ExecContext(ctx, l.upsertQuery(), name, l.cfg.Holder, now.Add(l.cfg.LeaseTTL)); err != nil {
+			return err
+		}
+		elected = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return elected, nil
+}
+
+// resign releases the lease, if this instance still holds it.
+func (l *Locker) resign(ctx context.Context, name string) error {
+	_, err := l.session.QueryPerformer(ctx).ExecContext(ctx,
+		l.query("UPDATE %s SET holder = '', expires_at = NULL WHERE name = ? AND holder = ?"),
+		name, l.cfg.Holder,
+	)
+	return err
+}
+
+func (l *Locker) upsertQuery() string {
+	if l.cfg.Dialect == txctx.MySQL {
+		return l.query("INSERT INTO %s (name, holder, expires_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE holder = VALUES(holder), expires_at = VALUES(expires_at)")
+	}
+	return l.query("INSERT INTO %s (name, holder, expires_at) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at")
+}
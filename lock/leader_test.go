@@ -0,0 +1,149 @@
+package lock
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func expectCampaign(mock sqlmock.Sqlmock, holder any, expiresAt any, elected bool) {
+	mock.ExpectBegin()
+	expectLockTimeout(mock, "0", "30000ms")
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(advisoryNamespace, "scheduler").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SELECT set_config").WithArgs("0").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"holder", "expires_at"})
+	if holder != nil {
+		rows.AddRow(holder, expiresAt)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT holder, expires_at FROM locks WHERE name = $1")).
+		WithArgs("scheduler").
+		WillReturnRows(rows)
+	if elected {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO locks (name, holder, expires_at) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at")).
+			WithArgs("scheduler", "instance-1", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestLocker_campaign(t *testing.T) {
+	tests := []struct {
+		name      string
+		holder    any
+		expiresAt any
+		elected   bool
+	}{
+		{name: "no lease", elected: true},
+		{name: "released", holder: "", expiresAt: nil, elected: true},
+		{name: "expired", holder: "instance-2", expiresAt: txtest.Now.Add(-time.Second), elected: true},
+		{name: "renewal", holder: "instance-1", expiresAt: txtest.Now.Add(time.Second), elected: true},
+		{name: "held by another instance", holder: "instance-2", expiresAt: txtest.Now.Add(time.Second), elected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, mock := newTestLocker(t, Config{})
+			expectCampaign(mock, tt.holder, tt.expiresAt, tt.elected)
+
+			elected, err := l.campaign(context.Background(), "scheduler")
+			require.NoError(t, err)
+			assert.Equal(t, tt.elected, elected)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestLocker_campaign_Dialects(t *testing.T) {
+	tests := []struct {
+		dialect txctx.Dialect
+		lock    func(mock sqlmock.Sqlmock)
+		upsert  string
+	}{
+		{
+			dialect: txctx.MySQL,
+			lock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("^" + regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM locks WHERE name = ?)") + "$").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery("^" + regexp.QuoteMeta("SELECT name FROM locks WHERE name = ? FOR UPDATE NOWAIT") + "$").
+					WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("scheduler"))
+			},
+			upsert: "INSERT INTO locks (name, holder, expires_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE holder = VALUES(holder), expires_at = VALUES(expires_at)",
+		},
+		{
+			dialect: txctx.SQLite,
+			lock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("^" + regexp.QuoteMeta("INSERT INTO locks (name, holder) VALUES (?, '') ON CONFLICT (name) DO UPDATE SET name = excluded.name") + "$").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			upsert: "INSERT INTO locks (name, holder, expires_at) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			l, mock := newTestLocker(t, Config{Dialect: tt.dialect})
+
+			mock.ExpectBegin()
+			tt.lock(mock)
+			mock.ExpectQuery("^" + regexp.QuoteMeta("SELECT holder, expires_at FROM locks WHERE name = ?") + "$").
+				WithArgs("scheduler").
+				WillReturnRows(sqlmock.NewRows([]string{"holder", "expires_at"}))
+			mock.ExpectExec("^"+regexp.QuoteMeta(tt.upsert)+"$").
+				WithArgs("scheduler", "instance-1", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			elected, err := l.campaign(context.Background(), "scheduler")
+			require.NoError(t, err)
+			assert.True(t, elected)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestLocker_Lead(t *testing.T) {
+	l, mock := newTestLocker(t, Config{LeaseTTL: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	expectCampaign(mock, nil, nil, true)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE locks SET holder = '', expires_at = NULL WHERE name = $1 AND holder = $2")).
+		WithArgs("scheduler", "instance-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	terms := 0
+	l.Lead(ctx, "scheduler", func(termCtx context.Context) {
+		terms++
+		cancel()
+		<-termCtx.Done()
+	})
+
+	assert.Equal(t, 1, terms)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLocker_Lead_LeadershipLost(t *testing.T) {
+	l, mock := newTestLocker(t, Config{LeaseTTL: 30 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	expectCampaign(mock, nil, nil, true)
+	expectCampaign(mock, "instance-2", txtest.Now.Add(time.Second), false)
+	mock.ExpectExec("UPDATE locks SET holder").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	lost := false
+	l.Lead(ctx, "scheduler", func(termCtx context.Context) {
+		<-termCtx.Done()
+		lost = ctx.Err() == nil
+		cancel()
+	})
+
+	assert.True(t, lost)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,212 @@
+// Package lock provides named locks scoped to the transaction in the context, for mutual
+// exclusion across instances: a lock is held until its transaction commits or rolls back.
+//
+// On Postgres, locks are transaction-level advisory locks. On MySQL, a lock is the row lock of
+// its row in the lock table, taken with `FOR UPDATE NOWAIT` (MySQL 8.0+): InnoDB holds it until
+// the transaction commits or rolls back, including when a savepoint taken before it is rolled
+// back. On SQLite, which has no row locks, a lock is a write to the row, which holds the
+// database's write lock until the transaction ends. Both require the lock table, see `Schema()`.
+//
+// MySQL's `GET_LOCK()` is not used: its locks belong to the connection rather than to the
+// transaction, so they would have to be released by hand before the commit, or be leaked
+// when the connection can no longer run statements.
+//
+// The lock table also stores the leases of the leader election run by `Locker.Lead()`.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/dberr"
+)
+
+// advisoryNamespace is the first key of the Postgres advisory locks, so that they don't collide
+// with the advisory locks of the application or of package eventstore.
+const advisoryNamespace = 0x74786c6b // "txlk"
+
+// ErrTimeout is returned when a lock could not be acquired before the timeout.
+var ErrTimeout = errors.New("lock: timed out waiting for the lock")
+
+// Config of a locker.
+type Config struct {
+	// Dialect of the database. Defaults to Postgres.
+	Dialect txctx.Dialect
+
+	// Table holding the locks on MySQL and SQLite, and the leases of the leaders. Defaults to "locks".
+	Table string
+
+	// Timeout is how long `Lock()` waits for a lock. Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// RetryInterval is the interval between two attempts of `Lock()` to acquire a lock held by
+	// another transaction, on MySQL and SQLite. Defaults to 100 milliseconds.
+	RetryInterval time.Duration
+
+	// LeaseTTL is the duration of the leadership of a leader that stopped renewing it.
+	// Leaders renew it every third of the TTL. Defaults to 15 seconds.
+	LeaseTTL time.Duration
+
+	// Holder identifies this instance in the leases. Defaults to a random ID.
+	Holder string
+}
+
+// Locker acquires named locks.
+type Locker struct {
+	session txctx.Session
+	cfg     Config
+	now     func() time.Time
+}
+
+// New creates a new locker using the given session.
+func New(session txctx.Session, cfg Config) *Locker {
+	if cfg.Dialect == 0 {
+		cfg.Dialect = txctx.Postgres
+	}
+	if cfg.Table == "" {
+		cfg.Table = "locks"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 100 * time.Millisecond
+	}
+	if cfg.LeaseTTL <= 0 {
+		cfg.LeaseTTL = 15 * time.Second
+	}
+	if cfg.Holder == "" {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		cfg.Holder = hex.EncodeToString(b)
+	}
+	return &Locker{
+		session: session,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// Lock acquires the named lock for the transaction in the context, waiting at most for the
+// configured timeout. `ErrTimeout` is returned if the lock is still held by another transaction
+// by then, and `txctx.ErrNoTransaction` if the context holds no transaction.
+//
+// The lock is released when the transaction commits or rolls back. A transaction can acquire
+// the same lock several times.
+//
+// On Postgres, the lock is waited for with `pg_advisory_xact_lock()` under a `lock_timeout`,
+// so that waiters acquire it in turn. Like any failed statement, a timeout aborts the
+// transaction, which can only be rolled back. On MySQL and SQLite, the lock is polled every
+// retry interval.
+func (l *Locker) Lock(ctx context.Context, name string) error {
+	if l.cfg.Dialect == txctx.Postgres {
+		return l.waitAdvisory(ctx, name)
+	}
+	timeout := time.NewTimer(l.cfg.Timeout)
+	defer timeout.Stop()
+	for {
+		acquired, err := l.TryLock(ctx, name)
+		if err != nil || acquired {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("%w: %q", ErrTimeout, name)
+		case <-time.After(l.cfg.RetryInterval):
+		}
+	}
+}
+
+// TryLock acquires the named lock for the transaction in the context if it is free, without
+// waiting. It returns false if the lock is held by another transaction, and
+// `txctx.ErrNoTransaction` if the context holds no transaction.
+//
+// On SQLite, the attempt waits for the busy timeout of the connection, if any. On MySQL, the
+// first attempt on a name creates its row, and waits for the transactions creating it as well.
+func (l *Locker) TryLock(ctx context.Context, name string) (bool, error) {
+	if !txctx.IsInTransaction(ctx) {
+		return false, txctx.ErrNoTransaction
+	}
+	p := l.session.QueryPerformer(ctx)
+	switch l.cfg.Dialect {
+	case txctx.MySQL:
+		return l.lockRow(ctx, p, name)
+	case txctx.SQLite:
+		_, err := p.ExecContext(ctx,
+			l.query("INSERT INTO %s (name, holder) VALUES (?, '') ON CONFLICT (name) DO UPDATE SET name = excluded.name"),
+			name,
+		)
+		if dberr.IsLockTimeout(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	var acquired bool
+	err := p.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1, hashtext($2))", advisoryNamespace, name).Scan(&acquired)
+	return acquired, err
+}
+
+// waitAdvisory waits for the advisory lock on Postgres, at most for the timeout, and restores
+// the lock timeout of the transaction once it is acquired.
+func (l *Locker) waitAdvisory(ctx context.Context, name string) error {
+	if !txctx.IsInTransaction(ctx) {
+		return txctx.ErrNoTransaction
+	}
+	p := l.session.QueryPerformer(ctx)
+	var previous string
+	if err := p.QueryRowContext(ctx, "SELECT current_setting('lock_timeout')").Scan(&previous); err != nil {
+		return err
+	}
+	// A zero lock_timeout would wait forever.
+	timeout := fmt.Sprintf("%dms", max(l.cfg.Timeout.Milliseconds(), 1))
+	if _, err := p.ExecContext(ctx, "SELECT set_config('lock_timeout', $1, true)", timeout); err != nil {
+		return err
+	}
+	if _, err := p.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2))", advisoryNamespace, name); err != nil {
+		if dberr.IsLockTimeout(err) {
+			return fmt.Errorf("%w: %q", ErrTimeout, name)
+		}
+		return err
+	}
+	_, err := p.ExecContext(ctx, "SELECT set_config('lock_timeout', $1, true)", previous)
+	return err
+}
+
+// lockRow locks the row of the lock on MySQL without waiting, and creates it on first use.
+func (l *Locker) lockRow(ctx context.Context, p txctx.Performer, name string) (bool, error) {
+	// The row is inserted before it is locked: locking a missing row takes a gap lock, on which
+	// the inserts of concurrent first uses would deadlock. The insert is skipped when the row
+	// exists, since it would wait for the transaction holding the lock.
+	var exists bool
+	err := p.QueryRowContext(ctx, l.query("SELECT EXISTS (SELECT 1 FROM %s WHERE name = ?)"), name).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		_, err := p.ExecContext(ctx, l.query("INSERT INTO %s (name, holder) VALUES (?, '') ON DUPLICATE KEY UPDATE name = name"), name)
+		if dberr.IsLockTimeout(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	var locked string
+	err = p.QueryRowContext(ctx, l.query("SELECT name FROM %s WHERE name = ? FOR UPDATE NOWAIT"), name).Scan(&locked)
+	if dberr.IsLockTimeout(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// query formats the query with the table name and rebinds its placeholders.
+func (l *Locker) query(query string) string {
+	return l.cfg.Dialect.Rebind(fmt.Sprintf(query, l.cfg.Table))
+}
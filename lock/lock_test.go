@@ -0,0 +1,246 @@
+package lock
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+// busyError mimics the errors of modernc.org/sqlite.
+type busyError struct{}
+
+func (busyError) Error() string { return "database is locked (5) (SQLITE_BUSY)" }
+func (busyError) Code() int     { return 5 }
+
+func newTestLocker(t *testing.T, cfg Config) (*Locker, sqlmock.Sqlmock) {
+	session, mock := txtest.Session(t)
+	if cfg.Holder == "" {
+		cfg.Holder = "instance-1"
+	}
+	l := New(session, cfg)
+	l.now = txtest.Clock
+	return l, mock
+}
+
+// pgError mimics the errors of jackc/pgx.
+type pgError struct {
+	Code    string
+	Message string
+}
+
+func (e *pgError) Error() string    { return e.Message }
+func (e *pgError) SQLState() string { return e.Code }
+
+func expectLockTimeout(mock sqlmock.Sqlmock, previous, timeout string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT current_setting('lock_timeout')")).
+		WillReturnRows(sqlmock.NewRows([]string{"current_setting"}).AddRow(previous))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT set_config('lock_timeout', $1, true)")).
+		WithArgs(timeout).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestLocker_Lock(t *testing.T) {
+	l, mock := newTestLocker(t, Config{Timeout: 5 * time.Second})
+
+	mock.ExpectBegin()
+	expectLockTimeout(mock, "1s", "5000ms")
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, hashtext($2))")).
+		WithArgs(advisoryNamespace, "nightly-report").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// The lock timeout of the transaction is restored
+	mock.ExpectExec(regexp.QuoteMeta("SELECT set_config('lock_timeout', $1, true)")).
+		WithArgs("1s").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := l.session.Transaction(context.Background(), func(ctx context.Context) error {
+		return l.Lock(ctx, "nightly-report")
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLocker_Lock_Timeout(t *testing.T) {
+	l, mock := newTestLocker(t, Config{})
+
+	mock.ExpectBegin()
+	expectLockTimeout(mock, "0", "30000ms")
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, hashtext($2))")).
+		WithArgs(advisoryNamespace, "nightly-report").
+		WillReturnError(&pgError{Code: "55P03", Message: "canceling statement due to lock timeout"})
+	mock.ExpectRollback()
+
+	err := l.session.Transaction(context.Background(), func(ctx context.Context) error {
+		return l.Lock(ctx, "nightly-report")
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLocker_TryLock(t *testing.T) {
+	l, mock := newTestLocker(t, Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_xact_lock($1, hashtext($2))")).
+		WithArgs(advisoryNamespace, "nightly-report").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(false))
+	mock.ExpectCommit()
+
+	err := l.session.Transaction(context.Background(), func(ctx context.Context) error {
+		acquired, err := l.TryLock(ctx, "nightly-report")
+		assert.False(t, acquired)
+		return err
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLocker_TryLock_NoTransaction(t *testing.T) {
+	l, _ := newTestLocker(t, Config{})
+
+	_, err := l.TryLock(context.Background(), "nightly-report")
+	assert.ErrorIs(t, err, txctx.ErrNoTransaction)
+	assert.ErrorIs(t, l.Lock(context.Background(), "nightly-report"), txctx.ErrNoTransaction)
+}
+
+// nowaitError mimics the errors of go-sql-driver/mysql.
+type nowaitError struct {
+	Number   uint16
+	SQLState [5]byte
+	Message  string
+}
+
+func (e *nowaitError) Error() string { return e.Message }
+
+func TestLocker_MySQL(t *testing.T) {
+	existsRow := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM locks WHERE name = ?)")
+	selectRow := regexp.QuoteMeta("SELECT name FROM locks WHERE name = ? FOR UPDATE NOWAIT")
+	insertRow := regexp.QuoteMeta("INSERT INTO locks (name, holder) VALUES (?, '') ON DUPLICATE KEY UPDATE name = name")
+	exists := func(exists bool) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"exists"}).AddRow(exists)
+	}
+
+	t.Run("row locked until commit", func(t *testing.T) {
+		l, mock := newTestLocker(t, Config{Dialect: txctx.MySQL})
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(existsRow).WithArgs("nightly-report").WillReturnRows(exists(true))
+		mock.ExpectQuery(selectRow).WithArgs("nightly-report").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("nightly-report"))
+		// First use of the lock: the row is created before it is locked
+		mock.ExpectQuery(existsRow).WithArgs("cleanup").WillReturnRows(exists(false))
+		mock.ExpectExec(insertRow).WithArgs("cleanup").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(selectRow).WithArgs("cleanup").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("cleanup"))
+		mock.ExpectCommit()
+
+		err := l.session.Transaction(context.Background(), func(ctx context.Context) error {
+			if err := l.Lock(ctx, "nightly-report"); err != nil {
+				return err
+			}
+			acquired, err := l.TryLock(ctx, "cleanup")
+			assert.True(t, acquired)
+			return err
+		})
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("held after a savepoint rollback", func(t *testing.T) {
+		l, mock := newTestLocker(t, Config{Dialect: txctx.MySQL})
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(existsRow).WillReturnRows(exists(true))
+		mock.ExpectQuery(selectRow).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("nightly-report"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		// Nothing to release: the row lock ends with the transaction
+		mock.ExpectCommit()
+
+		err := l.session.Transaction(context.Background(), func(ctx context.Context) error {
+			err := txctx.Savepoint(ctx, func(ctx context.Context) error {
+				if err := l.Lock(ctx, "nightly-report"); err != nil {
+					return err
+				}
+				return assert.AnError
+			})
+			assert.ErrorIs(t, err, assert.AnError)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		l, mock := newTestLocker(t, Config{Dialect: txctx.MySQL})
+		ctx, cancel := context.WithCancel(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(existsRow).WillReturnRows(exists(true))
+		mock.ExpectQuery(selectRow).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("nightly-report"))
+		mock.ExpectRollback()
+
+		err := l.session.Transaction(ctx, func(ctx context.Context) error {
+			if err := l.Lock(ctx, "nightly-report"); err != nil {
+				return err
+			}
+			cancel()
+			return ctx.Err()
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		l, mock := newTestLocker(t, Config{Dialect: txctx.MySQL, Timeout: 250 * time.Millisecond, RetryInterval: 100 * time.Millisecond})
+
+		mock.ExpectBegin()
+		for i := 0; i < 3; i++ {
+			mock.ExpectQuery(existsRow).WillReturnRows(exists(true))
+			mock.ExpectQuery(selectRow).WithArgs("nightly-report").WillReturnError(&nowaitError{
+				Number:  3572,
+				Message: "Statement aborted because lock(s) could not be acquired immediately and NOWAIT is set.",
+			})
+		}
+		mock.ExpectRollback()
+
+		err := l.session.Transaction(context.Background(), func(ctx context.Context) error {
+			return l.Lock(ctx, "nightly-report")
+		})
+		assert.ErrorIs(t, err, ErrTimeout)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestLocker_SQLite(t *testing.T) {
+	l, mock := newTestLocker(t, Config{Dialect: txctx.SQLite})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO locks (name, holder) VALUES (?, '') ON CONFLICT (name) DO UPDATE SET name = excluded.name")).
+		WithArgs("nightly-report").
+		WillReturnError(busyError{})
+	mock.ExpectExec("INSERT INTO locks").
+		WithArgs("nightly-report").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := l.session.Transaction(context.Background(), func(ctx context.Context) error {
+		acquired, err := l.TryLock(ctx, "nightly-report")
+		require.NoError(t, err)
+		assert.False(t, acquired)
+
+		acquired, err = l.TryLock(ctx, "nightly-report")
+		assert.True(t, acquired)
+		return err
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
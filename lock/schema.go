@@ -0,0 +1,42 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Schema returns the statements creating the lock table for the given dialect.
+func Schema(d txctx.Dialect, table string) []string {
+	switch d {
+	case txctx.MySQL:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	holder VARCHAR(64) NOT NULL DEFAULT '',
+	expires_at DATETIME(6)
+)`, table)}
+	case txctx.SQLite:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name TEXT NOT NULL PRIMARY KEY,
+	holder TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMP
+)`, table)}
+	}
+	return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	holder VARCHAR(64) NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ
+)`, table)}
+}
+
+// CreateTable creates the lock table if it doesn't exist.
+func (l *Locker) CreateTable(ctx context.Context) error {
+	p := l.session.QueryPerformer(ctx)
+	for _, stmt := range Schema(l.cfg.Dialect, l.cfg.Table) {
+		if _, err := p.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package lock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestSchema(t *testing.T) {
+	// The upserts of the locks and leases conflict on the name.
+	tests := []struct {
+		dialect txctx.Dialect
+		defs    []string
+	}{
+		{txctx.Postgres, []string{"name VARCHAR(255) NOT NULL PRIMARY KEY", "expires_at TIMESTAMPTZ"}},
+		{txctx.MySQL, []string{"name VARCHAR(255) NOT NULL PRIMARY KEY", "expires_at DATETIME(6)"}},
+		{txctx.SQLite, []string{"name TEXT NOT NULL PRIMARY KEY", "expires_at TIMESTAMP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			stmts := Schema(tt.dialect, "locks")
+			require.Len(t, stmts, 1)
+			assert.Subset(t, txtest.Definitions(stmts[0]), tt.defs)
+		})
+	}
+}
+
+func TestLocker_CreateTable(t *testing.T) {
+	l, mock := newTestLocker(t, Config{Dialect: txctx.MySQL, Table: "mutexes"})
+	mock.ExpectExec(`(?s)^CREATE TABLE IF NOT EXISTS mutexes \(.*expires_at DATETIME\(6\)\s*\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, l.CreateTable(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
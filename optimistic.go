@@ -0,0 +1,115 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrConcurrentModification is matched by every *ConcurrentModificationError.
+var ErrConcurrentModification = errors.New("txctx: concurrent modification")
+
+// ConcurrentModificationError is returned when a versioned update or delete matched no row:
+// the row was modified or deleted since it was read.
+type ConcurrentModificationError struct {
+	Entity string
+	ID     any
+	// Version is the version the row was expected to be at.
+	Version int64
+}
+
+func (e *ConcurrentModificationError) Error() string {
+	return fmt.Sprintf("txctx: %s %v was modified concurrently, expected version %d", e.Entity, e.ID, e.Version)
+}
+
+// Is makes the error match `ErrConcurrentModification`.
+func (e *ConcurrentModificationError) Is(target error) bool {
+	return target == ErrConcurrentModification
+}
+
+// VersionedConfig describes a table with a version column.
+type VersionedConfig struct {
+	// Table holding the rows.
+	Table string
+
+	// Entity names the rows in the errors. Defaults to the table.
+	Entity string
+
+	// IDColumn is the column identifying the rows. Defaults to "id".
+	IDColumn string
+
+	// VersionColumn is the column holding the version of the rows. Defaults to "version".
+	VersionColumn string
+}
+
+// VersionedTable runs optimistic concurrency control on a table with a version column: updates
+// and deletes only apply to rows still at the version the caller read, and updates increment it.
+type VersionedTable struct {
+	session Session
+	cfg     VersionedConfig
+}
+
+// NewVersionedTable creates a versioned table running its statements with the given session,
+// in the dialect of the session.
+func NewVersionedTable(session Session, cfg VersionedConfig) *VersionedTable {
+	if cfg.Entity == "" {
+		cfg.Entity = cfg.Table
+	}
+	if cfg.IDColumn == "" {
+		cfg.IDColumn = "id"
+	}
+	if cfg.VersionColumn == "" {
+		cfg.VersionColumn = "version"
+	}
+	return &VersionedTable{session: session, cfg: cfg}
+}
+
+// Update sets the columns of the row, provided it is at the given version, and returns the new
+// version of the row. If the row was modified or deleted since, a *ConcurrentModificationError
+// matching `ErrConcurrentModification` is returned.
+func (v *VersionedTable) Update(ctx context.Context, id any, version int64, set map[string]any) (int64, error) {
+	columns := make([]string, 0, len(set))
+	for c := range set {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+
+	var b strings.Builder
+	args := make([]any, 0, len(set)+2)
+	fmt.Fprintf(&b, "UPDATE %s SET ", v.cfg.Table)
+	for _, c := range columns {
+		fmt.Fprintf(&b, "%s = ?, ", c)
+		args = append(args, set[c])
+	}
+	fmt.Fprintf(&b, "%[1]s = %[1]s + 1 WHERE %[2]s = ? AND %[1]s = ?", v.cfg.VersionColumn, v.cfg.IDColumn)
+	args = append(args, id, version)
+
+	if err := v.exec(ctx, b.String(), id, version, args...); err != nil {
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+// Delete deletes the row, provided it is at the given version. If the row was modified or
+// deleted since, a *ConcurrentModificationError matching `ErrConcurrentModification` is returned.
+func (v *VersionedTable) Delete(ctx context.Context, id any, version int64) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s = ?", v.cfg.Table, v.cfg.IDColumn, v.cfg.VersionColumn)
+	return v.exec(ctx, query, id, version, id, version)
+}
+
+func (v *VersionedTable) exec(ctx context.Context, query string, id any, version int64, args ...any) error {
+	res, err := v.session.QueryPerformer(ctx).ExecContext(ctx, DialectOf(v.session).Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &ConcurrentModificationError{Entity: v.cfg.Entity, ID: id, Version: version}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package txctx
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionedTable_Update(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	orders := NewVersionedTable(SQL(db, nil), VersionedConfig{Table: "orders", Entity: "order"})
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET status = $1, total = $2, version = version + 1 WHERE id = $3 AND version = $4")).
+		WithArgs("paid", 120, 42, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET status = $1, version = version + 1 WHERE id = $2 AND version = $3")).
+		WithArgs("shipped", 42, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	version, err := orders.Update(context.Background(), 42, 3, map[string]any{"total": 120, "status": "paid"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), version)
+
+	_, err = orders.Update(context.Background(), 42, 3, map[string]any{"status": "shipped"})
+	assert.ErrorIs(t, err, ErrConcurrentModification)
+	var conflict *ConcurrentModificationError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, &ConcurrentModificationError{Entity: "order", ID: 42, Version: 3}, conflict)
+	assert.Equal(t, "txctx: order 42 was modified concurrently, expected version 3", err.Error())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVersionedTable_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithDialect(MySQL))
+	accounts := NewVersionedTable(session, VersionedConfig{Table: "accounts", IDColumn: "account_id", VersionColumn: "revision"})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM accounts WHERE account_id = ? AND revision = ?")).
+		WithArgs("acc-1", 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return accounts.Delete(ctx, "acc-1", 7)
+	})
+	assert.ErrorIs(t, err, ErrConcurrentModification)
+	var conflict *ConcurrentModificationError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "accounts", conflict.Entity)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,247 @@
+// Package queue implements a job queue stored in the database, so that jobs are enqueued
+// atomically with the business writes of the transaction in the context.
+//
+// Workers claim a job by leasing it for the visibility timeout, then run its handler and
+// delete the job in the same transaction. A job whose handler fails is retried with a backoff,
+// and moved to the dead letters once it runs out of attempts. A job whose worker died becomes
+// visible again when its lease expires.
+//
+// On Postgres and MySQL, jobs are claimed with `FOR UPDATE SKIP LOCKED`, so that workers
+// never wait for each other. On SQLite, which serializes the writers, jobs are claimed with
+// an update conditioned on the number of attempts of the job, which changes with every claim.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// ErrNotDead is returned when retrying a job that is not dead-lettered.
+var ErrNotDead = errors.New("queue: job is not dead")
+
+const (
+	statusPending = "pending"
+	statusDead    = "dead"
+)
+
+// Job is a job of the queue.
+type Job struct {
+	ID       int64
+	Queue    string
+	Kind     string
+	Payload  []byte
+	Priority int
+	RunAt    time.Time
+	// Attempts is the number of times the job was claimed, including the current one.
+	Attempts    int
+	MaxAttempts int
+	// LastError is the error of the last failed attempt.
+	LastError string
+	CreatedAt time.Time
+}
+
+// Config of a queue.
+type Config struct {
+	// Dialect of the database. Defaults to Postgres.
+	Dialect txctx.Dialect
+
+	// Table holding the jobs. Defaults to "jobs".
+	Table string
+
+	// Queue is the name of the queue. Several queues can share the same table. Defaults to "default".
+	Queue string
+
+	// MaxAttempts is the default number of attempts of a job before it is dead-lettered. Defaults to 5.
+	MaxAttempts int
+
+	// Backoff returns the delay before retrying a job that failed the given number of times.
+	// Defaults to an exponential backoff starting at one second, capped at one hour.
+	Backoff func(attempts int) time.Duration
+
+	// VisibilityTimeout is how long a claimed job is hidden from the other workers. The handler's
+	// context is canceled once it expires. Defaults to 5 minutes.
+	VisibilityTimeout time.Duration
+
+	// Concurrency is the number of workers run by `Run()`. Defaults to 1.
+	Concurrency int
+
+	// PollInterval is the interval between two polls of a worker that found no job. Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Queue of jobs.
+type Queue struct {
+	session  txctx.Session
+	cfg      Config
+	handlers map[string]Handler
+	now      func() time.Time
+	newLease func() string
+}
+
+// New creates a new queue using the given session.
+func New(session txctx.Session, cfg Config) *Queue {
+	if cfg.Dialect == 0 {
+		cfg.Dialect = txctx.Postgres
+	}
+	if cfg.Table == "" {
+		cfg.Table = "jobs"
+	}
+	if cfg.Queue == "" {
+		cfg.Queue = "default"
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Backoff == nil {
+		cfg.Backoff = ExponentialBackoff(time.Second, time.Hour)
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 5 * time.Minute
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	return &Queue{
+		session:  session,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+		now:      time.Now,
+		newLease: newLease,
+	}
+}
+
+// ExponentialBackoff returns a backoff doubling the delay after every failure, from base up to maxDelay.
+func ExponentialBackoff(base, maxDelay time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 1; i < attempts && d < maxDelay; i++ {
+			d *= 2
+		}
+		return min(d, maxDelay)
+	}
+}
+
+type enqueueOptions struct {
+	runAt       time.Time
+	delay       time.Duration
+	priority    int
+	maxAttempts int
+}
+
+// EnqueueOption configures an enqueued job.
+type EnqueueOption func(*enqueueOptions)
+
+// Delay runs the job once the delay elapsed.
+func Delay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.delay = d
+	}
+}
+
+// At runs the job at the given time.
+func At(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = t
+	}
+}
+
+// Priority sets the priority of the job. Jobs with a higher priority are claimed first. Defaults to 0.
+func Priority(p int) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.priority = p
+	}
+}
+
+// MaxAttempts overrides the number of attempts of the job before it is dead-lettered.
+func MaxAttempts(n int) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// Enqueue adds a job of the given kind and returns its ID. Called with the context of a transaction,
+// the job is only visible to the workers once the transaction commits.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload []byte, opts ...EnqueueOption) (int64, error) {
+	now := q.now().UTC()
+	o := enqueueOptions{maxAttempts: q.cfg.MaxAttempts}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	runAt := now.Add(o.delay)
+	if !o.runAt.IsZero() {
+		runAt = o.runAt.UTC()
+	}
+
+	query := q.query("INSERT INTO %s (queue, kind, payload, priority, status, run_at, attempts, max_attempts, last_error, created_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?, '', ?)")
+	args := []any{q.cfg.Queue, kind, payload, o.priority, statusPending, runAt, o.maxAttempts, now}
+	p := q.session.QueryPerformer(ctx)
+	if q.cfg.Dialect == txctx.Postgres {
+		var id int64
+		err := p.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	res, err := p.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeadJobs returns at most limit dead-lettered jobs, most recent first.
+func (q *Queue) DeadJobs(ctx context.Context, limit int) ([]Job, error) {
+	rows, err := q.session.QueryPerformer(ctx).QueryContext(ctx,
+		q.query("SELECT "+jobColumns+" FROM %s WHERE queue = ? AND status = ? ORDER BY run_at DESC, id DESC LIMIT ?"),
+		q.cfg.Queue, statusDead, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		if err := rows.Scan(j.fields()...); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Retry moves a dead-lettered job back to the queue, with a fresh set of attempts.
+func (q *Queue) Retry(ctx context.Context, id int64) error {
+	res, err := q.session.QueryPerformer(ctx).ExecContext(ctx,
+		q.query("UPDATE %s SET status = ?, attempts = 0, run_at = ? WHERE id = ? AND queue = ? AND status = ?"),
+		statusPending, q.now().UTC(), id, q.cfg.Queue, statusDead,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %d", ErrNotDead, id)
+	}
+	return nil
+}
+
+const jobColumns = "id, queue, kind, payload, priority, run_at, attempts, max_attempts, last_error, created_at"
+
+func (j *Job) fields() []any {
+	return []any{&j.ID, &j.Queue, &j.Kind, &j.Payload, &j.Priority, &j.RunAt, &j.Attempts, &j.MaxAttempts, &j.LastError, &j.CreatedAt}
+}
+
+// query formats the query with the table name and rebinds its placeholders.
+func (q *Queue) query(query string) string {
+	return q.cfg.Dialect.Rebind(fmt.Sprintf(query, q.cfg.Table))
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func newTestQueue(t *testing.T, cfg Config) (*Queue, sqlmock.Sqlmock) {
+	session, mock := txtest.Session(t)
+	q := New(session, cfg)
+	q.now = txtest.Clock
+	q.newLease = func() string { return "lease-1" }
+	return q, mock
+}
+
+func jobRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "queue", "kind", "payload", "priority", "run_at", "attempts", "max_attempts", "last_error", "created_at"})
+}
+
+func TestQueue_Enqueue(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO jobs (queue, kind, payload, priority, status, run_at, attempts, max_attempts, last_error, created_at) VALUES ($1, $2, $3, $4, $5, $6, 0, $7, '', $8) RETURNING id")).
+		WithArgs("default", "send_receipt", []byte(`{"order":1}`), 10, statusPending, txtest.Now.Add(time.Minute), 5, txtest.Now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
+
+	var id int64
+	err := q.session.Transaction(context.Background(), func(ctx context.Context) error {
+		if _, err := q.session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO orders (id) VALUES (1)"); err != nil {
+			return err
+		}
+		var err error
+		id, err = q.Enqueue(ctx, "send_receipt", []byte(`{"order":1}`), Delay(time.Minute), Priority(10))
+		return err
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Enqueue_Scheduled(t *testing.T) {
+	q, mock := newTestQueue(t, Config{Dialect: txctx.SQLite, Queue: "mails"})
+	at := time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO jobs (queue, kind, payload, priority, status, run_at, attempts, max_attempts, last_error, created_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?, '', ?)")).
+		WithArgs("mails", "digest", []byte(nil), 0, statusPending, at, 2, txtest.Now).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	id, err := q.Enqueue(context.Background(), "digest", nil, At(at), MaxAttempts(2))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Enqueue_Dialects(t *testing.T) {
+	const insert = "INSERT INTO jobs (queue, kind, payload, priority, status, run_at, attempts, max_attempts, last_error, created_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?, '', ?)"
+
+	t.Run("postgres", func(t *testing.T) {
+		q, mock := newTestQueue(t, Config{Dialect: txctx.Postgres})
+
+		mock.ExpectQuery("^" + regexp.QuoteMeta(txctx.Postgres.Rebind(insert)+" RETURNING id") + "$").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+		id, err := q.Enqueue(context.Background(), "digest", nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	// MySQL and SQLite have no RETURNING clause for inserts, or not in every supported version.
+	for _, d := range []txctx.Dialect{txctx.MySQL, txctx.SQLite} {
+		t.Run(d.String(), func(t *testing.T) {
+			q, mock := newTestQueue(t, Config{Dialect: d})
+
+			mock.ExpectExec("^" + regexp.QuoteMeta(insert) + "$").
+				WillReturnResult(sqlmock.NewResult(7, 1))
+
+			id, err := q.Enqueue(context.Background(), "digest", nil)
+			require.NoError(t, err)
+			assert.Equal(t, int64(7), id)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestQueue_DeadJobs(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, queue, kind, payload, priority, run_at, attempts, max_attempts, last_error, created_at FROM jobs WHERE queue = $1 AND status = $2 ORDER BY run_at DESC, id DESC LIMIT $3")).
+		WithArgs("default", statusDead, 10).
+		WillReturnRows(jobRows().AddRow(3, "default", "send_receipt", nil, 0, txtest.Now, 5, 5, "smtp down", txtest.Now))
+
+	jobs, err := q.DeadJobs(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "smtp down", jobs[0].LastError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Retry(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET status = $1, attempts = 0, run_at = $2 WHERE id = $3 AND queue = $4 AND status = $5")).
+		WithArgs(statusPending, txtest.Now, int64(3), "default", statusDead).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE jobs SET status").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, q.Retry(context.Background(), 3))
+	assert.ErrorIs(t, q.Retry(context.Background(), 4), ErrNotDead)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, time.Minute)
+
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 8*time.Second, backoff(4))
+	assert.Equal(t, time.Minute, backoff(10))
+	assert.Equal(t, time.Minute, backoff(1000))
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Schema returns the statements creating the table of jobs for the given dialect.
+func Schema(d txctx.Dialect, table string) []string {
+	switch d {
+	case txctx.MySQL:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	queue VARCHAR(255) NOT NULL,
+	kind VARCHAR(255) NOT NULL,
+	payload LONGBLOB,
+	priority INT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	run_at DATETIME(6) NOT NULL,
+	attempts INT NOT NULL,
+	max_attempts INT NOT NULL,
+	last_error TEXT NOT NULL,
+	lease VARCHAR(64) NOT NULL DEFAULT '',
+	locked_until DATETIME(6),
+	created_at DATETIME(6) NOT NULL,
+	INDEX %[1]s_ready (queue, status, priority, run_at)
+)`, table)}
+	case txctx.SQLite:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	payload BLOB,
+	priority INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	run_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT NOT NULL,
+	lease TEXT NOT NULL DEFAULT '',
+	locked_until TIMESTAMP,
+	created_at TIMESTAMP NOT NULL
+)`, table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_ready ON %[1]s (queue, status, priority, run_at)", table),
+		}
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	queue VARCHAR(255) NOT NULL,
+	kind VARCHAR(255) NOT NULL,
+	payload BYTEA,
+	priority INTEGER NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL,
+	attempts INTEGER NOT NULL,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT NOT NULL,
+	lease VARCHAR(64) NOT NULL DEFAULT '',
+	locked_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL
+)`, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_ready ON %[1]s (queue, status, priority DESC, run_at)", table),
+	}
+}
+
+// CreateTable creates the table of jobs if it doesn't exist.
+func (q *Queue) CreateTable(ctx context.Context) error {
+	p := q.session.QueryPerformer(ctx)
+	for _, stmt := range Schema(q.cfg.Dialect, q.cfg.Table) {
+		if _, err := p.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestSchema(t *testing.T) {
+	// The IDs returned by Enqueue are generated by the database.
+	tests := []struct {
+		dialect txctx.Dialect
+		defs    []string
+		indexes []string
+	}{
+		{
+			dialect: txctx.Postgres,
+			defs: []string{
+				"id BIGSERIAL PRIMARY KEY",
+				"payload BYTEA",
+				"locked_until TIMESTAMPTZ",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS jobs_ready ON jobs (queue, status, priority DESC, run_at)"},
+		},
+		{
+			// MySQL has no CREATE INDEX IF NOT EXISTS, the index is declared with the table.
+			dialect: txctx.MySQL,
+			defs: []string{
+				"id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY",
+				"payload LONGBLOB",
+				"locked_until DATETIME(6)",
+				"INDEX jobs_ready (queue, status, priority, run_at)",
+			},
+		},
+		{
+			dialect: txctx.SQLite,
+			defs: []string{
+				"id INTEGER PRIMARY KEY AUTOINCREMENT",
+				"payload BLOB",
+				"locked_until TIMESTAMP",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS jobs_ready ON jobs (queue, status, priority, run_at)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			stmts := Schema(tt.dialect, "jobs")
+			require.Len(t, stmts, 1+len(tt.indexes))
+			assert.Subset(t, txtest.Definitions(stmts[0]), tt.defs)
+			for i, index := range tt.indexes {
+				assert.Equal(t, index, stmts[1+i])
+			}
+		})
+	}
+}
+
+func TestQueue_CreateTable(t *testing.T) {
+	q, mock := newTestQueue(t, Config{Dialect: txctx.SQLite, Table: "tasks"})
+	mock.ExpectExec(`(?s)^CREATE TABLE IF NOT EXISTS tasks \(\s*id INTEGER PRIMARY KEY AUTOINCREMENT,.*\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^CREATE INDEX IF NOT EXISTS tasks_ready ON tasks \(queue, status, priority, run_at\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, q.CreateTable(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,195 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// ErrLeaseLost is returned when a job's lease expired and the job was claimed by another
+// worker before it completed. The handler's writes are rolled back.
+var ErrLeaseLost = errors.New("queue: job lease lost")
+
+// Handler processes a job. It runs in the transaction deleting the job, so its writes through
+// the transaction in the context are committed if and only if the job completes.
+type Handler func(ctx context.Context, job *Job) error
+
+// Handle registers the handler of the jobs of the given kind. Handlers must be registered
+// before the workers are started.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.handlers[kind] = h
+}
+
+// Process claims the next job ready to run and processes it. It returns false if no job was ready.
+// If the handler fails, the job is scheduled for a retry, or dead-lettered once it ran out of
+// attempts, and the handler's error is returned.
+func (q *Queue) Process(ctx context.Context) (bool, error) {
+	job, lease, err := q.claim(ctx)
+	if err != nil || job == nil {
+		return false, err
+	}
+	return true, q.process(ctx, job, lease)
+}
+
+// Run runs the workers until the context is canceled. Failures are logged with slog.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		processed, err := q.Process(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("queue: job failed", slog.String("queue", q.cfg.Queue), slog.Any("error", err))
+		}
+		if processed {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.cfg.PollInterval):
+		}
+	}
+}
+
+// claim leases the next job ready to run. It returns a nil job if none is ready.
+func (q *Queue) claim(ctx context.Context) (*Job, string, error) {
+	if q.cfg.Dialect == txctx.SQLite {
+		return q.claimConditionally(ctx)
+	}
+
+	var job *Job
+	lease := q.newLease()
+	err := q.session.Transaction(ctx, func(ctx context.Context) error {
+		now := q.now().UTC()
+		p := q.session.QueryPerformer(ctx)
+		j := &Job{}
+		err := p.QueryRowContext(ctx,
+			q.query("SELECT "+jobColumns+" FROM %s WHERE queue = ? AND status = ? AND run_at <= ? AND (locked_until IS NULL OR locked_until <= ?) ORDER BY priority DESC, run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED"),
+			q.cfg.Queue, statusPending, now, now,
+		).Scan(j.fields()...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = p.ExecContext(ctx,
+			q.query("UPDATE %s SET attempts = attempts + 1, lease = ?, locked_until = ? WHERE id = ?"),
+			lease, now.Add(q.cfg.VisibilityTimeout), j.ID,
+		)
+		j.Attempts++
+		job = j
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return job, lease, nil
+}
+
+// claimConditionally leases the next job ready to run with an update conditioned on its
+// number of attempts, which changes with every claim. It returns a nil job if none is ready,
+// or if another worker claimed it first.
+func (q *Queue) claimConditionally(ctx context.Context) (*Job, string, error) {
+	now := q.now().UTC()
+	p := q.session.QueryPerformer(ctx)
+	j := &Job{}
+	err := p.QueryRowContext(ctx,
+		q.query("SELECT "+jobColumns+" FROM %s WHERE queue = ? AND status = ? AND run_at <= ? AND (locked_until IS NULL OR locked_until <= ?) ORDER BY priority DESC, run_at, id LIMIT 1"),
+		q.cfg.Queue, statusPending, now, now,
+	).Scan(j.fields()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	lease := q.newLease()
+	res, err := p.ExecContext(ctx,
+		q.query("UPDATE %s SET attempts = attempts + 1, lease = ?, locked_until = ? WHERE id = ? AND attempts = ? AND (locked_until IS NULL OR locked_until <= ?)"),
+		lease, now.Add(q.cfg.VisibilityTimeout), j.ID, j.Attempts, now,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return nil, "", err
+	}
+	j.Attempts++
+	return j, lease, nil
+}
+
+// process runs the handler of the job and deletes the job in the same transaction.
+func (q *Queue) process(ctx context.Context, job *Job, lease string) error {
+	jobCtx, cancel := context.WithTimeout(ctx, q.cfg.VisibilityTimeout)
+	defer cancel()
+
+	err := q.session.Transaction(jobCtx, func(ctx context.Context) error {
+		h, ok := q.handlers[job.Kind]
+		if !ok {
+			return fmt.Errorf("queue: no handler for jobs of kind %q", job.Kind)
+		}
+		if err := h(ctx, job); err != nil {
+			return err
+		}
+		res, err := q.session.QueryPerformer(ctx).ExecContext(ctx,
+			q.query("DELETE FROM %s WHERE id = ? AND lease = ?"),
+			job.ID, lease,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrLeaseLost
+		}
+		return nil
+	})
+	if err == nil || errors.Is(err, ErrLeaseLost) {
+		return err
+	}
+	return errors.Join(err, q.fail(context.WithoutCancel(ctx), job, lease, err))
+}
+
+// fail schedules a retry of the job, or dead-letters it once it ran out of attempts.
+func (q *Queue) fail(ctx context.Context, job *Job, lease string, cause error) error {
+	now := q.now().UTC()
+	status, runAt := statusPending, now.Add(q.cfg.Backoff(job.Attempts))
+	if job.Attempts >= job.MaxAttempts {
+		status, runAt = statusDead, now
+	}
+	_, err := q.session.QueryPerformer(ctx).ExecContext(ctx,
+		q.query("UPDATE %s SET status = ?, run_at = ?, last_error = ?, lease = '', locked_until = NULL WHERE id = ? AND lease = ?"),
+		status, runAt, cause.Error(), job.ID, lease,
+	)
+	return err
+}
+
+func newLease() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+const claimQuery = "SELECT id, queue, kind, payload, priority, run_at, attempts, max_attempts, last_error, created_at FROM jobs WHERE queue = $1 AND status = $2 AND run_at <= $3 AND (locked_until IS NULL OR locked_until <= $4) ORDER BY priority DESC, run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED"
+
+func expectClaim(mock sqlmock.Sqlmock, attempts, maxAttempts int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimQuery)).
+		WithArgs("default", statusPending, txtest.Now, txtest.Now).
+		WillReturnRows(jobRows().AddRow(3, "default", "send_receipt", []byte(`{"order":1}`), 0, txtest.Now, attempts, maxAttempts, "", txtest.Now))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET attempts = attempts + 1, lease = $1, locked_until = $2 WHERE id = $3")).
+		WithArgs("lease-1", txtest.Now.Add(5*time.Minute), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestQueue_Process(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+	var handled *Job
+	q.Handle("send_receipt", func(ctx context.Context, job *Job) error {
+		handled = job
+		_, err := q.session.QueryPerformer(ctx).ExecContext(ctx, "UPDATE orders SET receipt_sent = true")
+		return err
+	})
+
+	expectClaim(mock, 0, 5)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM jobs WHERE id = $1 AND lease = $2")).
+		WithArgs(int64(3), "lease-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	processed, err := q.Process(context.Background())
+	require.NoError(t, err)
+	assert.True(t, processed)
+	require.NotNil(t, handled)
+	assert.Equal(t, 1, handled.Attempts)
+	assert.Equal(t, []byte(`{"order":1}`), handled.Payload)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Process_NoJob(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimQuery)).WillReturnRows(jobRows())
+	mock.ExpectCommit()
+
+	processed, err := q.Process(context.Background())
+	require.NoError(t, err)
+	assert.False(t, processed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Process_Retry(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+	handlerErr := errors.New("smtp down")
+	q.Handle("send_receipt", func(ctx context.Context, job *Job) error {
+		return handlerErr
+	})
+
+	expectClaim(mock, 1, 5)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET status = $1, run_at = $2, last_error = $3, lease = '', locked_until = NULL WHERE id = $4 AND lease = $5")).
+		WithArgs(statusPending, txtest.Now.Add(2*time.Second), sqlmock.AnyArg(), int64(3), "lease-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	processed, err := q.Process(context.Background())
+	assert.True(t, processed)
+	assert.ErrorIs(t, err, handlerErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Process_DeadLetter(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+
+	// No handler for the kind
+	expectClaim(mock, 4, 5)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectExec("UPDATE jobs SET status").
+		WithArgs(statusDead, txtest.Now, sqlmock.AnyArg(), int64(3), "lease-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	processed, err := q.Process(context.Background())
+	assert.True(t, processed)
+	assert.ErrorContains(t, err, `no handler for jobs of kind "send_receipt"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Process_LeaseLost(t *testing.T) {
+	q, mock := newTestQueue(t, Config{})
+	q.Handle("send_receipt", func(ctx context.Context, job *Job) error {
+		return nil
+	})
+
+	expectClaim(mock, 0, 5)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM jobs").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	processed, err := q.Process(context.Background())
+	assert.True(t, processed)
+	assert.ErrorIs(t, err, ErrLeaseLost)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueue_Process_SQLite(t *testing.T) {
+	t.Run("claimed", func(t *testing.T) {
+		q, mock := newTestQueue(t, Config{Dialect: txctx.SQLite})
+		q.Handle("send_receipt", func(ctx context.Context, job *Job) error {
+			return nil
+		})
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, queue, kind, payload, priority, run_at, attempts, max_attempts, last_error, created_at FROM jobs WHERE queue = ? AND status = ? AND run_at <= ? AND (locked_until IS NULL OR locked_until <= ?) ORDER BY priority DESC, run_at, id LIMIT 1")).
+			WillReturnRows(jobRows().AddRow(3, "default", "send_receipt", nil, 0, txtest.Now, 2, 5, "", txtest.Now))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET attempts = attempts + 1, lease = ?, locked_until = ? WHERE id = ? AND attempts = ? AND (locked_until IS NULL OR locked_until <= ?)")).
+			WithArgs("lease-1", txtest.Now.Add(5*time.Minute), int64(3), 2, txtest.Now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM jobs WHERE id = ? AND lease = ?")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		processed, err := q.Process(context.Background())
+		require.NoError(t, err)
+		assert.True(t, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("claimed by another worker", func(t *testing.T) {
+		q, mock := newTestQueue(t, Config{Dialect: txctx.SQLite})
+
+		mock.ExpectQuery("SELECT id, queue").
+			WillReturnRows(jobRows().AddRow(3, "default", "send_receipt", nil, 0, txtest.Now, 2, 5, "", txtest.Now))
+		mock.ExpectExec("UPDATE jobs SET attempts").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		processed, err := q.Process(context.Background())
+		require.NoError(t, err)
+		assert.False(t, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestQueue_Run(t *testing.T) {
+	q, mock := newTestQueue(t, Config{PollInterval: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Handle("send_receipt", func(ctx context.Context, job *Job) error {
+		cancel()
+		return nil
+	})
+
+	expectClaim(mock, 0, 5)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM jobs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers did not stop")
+	}
+}
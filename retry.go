@@ -0,0 +1,67 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy decides whether a failed transaction is run again. It is given the number of
+// attempts so far and the error of the last one, and returns the delay before the next attempt,
+// or false to give up and return the error.
+type RetryPolicy func(attempts int, err error) (delay time.Duration, retry bool)
+
+// WithRetryPolicy makes `Transaction()` run the whole transaction again when it fails and the
+// policy allows it. The function given to `Transaction()` must then be safe to run several times.
+//
+// Transactions whose commit outcome is unknown are never retried, see `ErrCommitOutcomeUnknown`,
+// and neither are transactions whose context is done.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(s *SQLSession) {
+		s.retry = p
+	}
+}
+
+// RetryOn returns a policy running a transaction at most maxAttempts times while it fails with
+// an error matched by retryable, such as `dberr.IsRetryable()`. It waits for backoff(attempts)
+// between two attempts, or not at all if backoff is nil.
+func RetryOn(maxAttempts int, backoff func(attempts int) time.Duration, retryable func(err error) bool) RetryPolicy {
+	return func(attempts int, err error) (time.Duration, bool) {
+		if attempts >= maxAttempts || !retryable(err) {
+			return 0, false
+		}
+		if backoff == nil {
+			return 0, true
+		}
+		return backoff(attempts), true
+	}
+}
+
+// RetryConcurrentModifications returns a policy running a transaction at most maxAttempts times
+// while it fails with `ErrConcurrentModification`, so that it reads the rows again.
+func RetryConcurrentModifications(maxAttempts int) RetryPolicy {
+	return RetryOn(maxAttempts, nil, func(err error) bool {
+		return errors.Is(err, ErrConcurrentModification)
+	})
+}
+
+// retryTransaction runs the transaction until it succeeds or the retry policy gives up.
+func (s SQLSession) retryTransaction(ctx context.Context, f func(context.Context) error) error {
+	for attempts := 1; ; attempts++ {
+		err := s.transaction(ctx, f)
+		if err == nil || errors.Is(err, ErrCommitOutcomeUnknown) || ctx.Err() != nil {
+			return err
+		}
+		delay, retry := s.retry(attempts, err)
+		if !retry {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransaction_RetryPolicy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithRetryPolicy(RetryConcurrentModifications(3)))
+	orders := NewVersionedTable(session, VersionedConfig{Table: "orders"})
+
+	for version := 1; version <= 2; version++ {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT version FROM orders").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+		mock.ExpectExec("UPDATE orders").WithArgs("paid", 1, version).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT version FROM orders").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	mock.ExpectExec("UPDATE orders").WithArgs("paid", 1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	attempts := 0
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		attempts++
+		var version int64
+		if err := session.QueryPerformer(ctx).QueryRowContext(ctx, "SELECT version FROM orders WHERE id = 1").Scan(&version); err != nil {
+			return err
+		}
+		_, err := orders.Update(ctx, 1, version, map[string]any{"status": "paid"})
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransaction_RetryPolicy_GivesUp(t *testing.T) {
+	conflict := &ConcurrentModificationError{Entity: "orders", ID: 1, Version: 1}
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{name: "too many attempts", err: conflict, attempts: 2},
+		{name: "not retryable", err: errors.New("out of stock"), attempts: 1},
+		{name: "commit outcome unknown", err: fmt.Errorf("%w: connection reset", ErrCommitOutcomeUnknown), attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			var delays []int
+			policy := RetryOn(2, func(attempts int) time.Duration {
+				delays = append(delays, attempts)
+				return time.Millisecond
+			}, func(err error) bool {
+				return errors.Is(err, ErrConcurrentModification) || errors.Is(err, ErrCommitOutcomeUnknown)
+			})
+			session := SQL(db, nil, WithRetryPolicy(policy))
+			for range tt.attempts {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			}
+
+			attempts := 0
+			err = session.Transaction(context.Background(), func(ctx context.Context) error {
+				attempts++
+				return tt.err
+			})
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.attempts, attempts)
+			assert.Len(t, delays, tt.attempts-1)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestTransaction_RetryPolicy_Canceled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithRetryPolicy(RetryOn(5, func(int) time.Duration { return time.Hour }, func(error) bool { return true })))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	attempts := 0
+	err = session.Transaction(ctx, func(ctx context.Context) error {
+		attempts++
+		return ErrConcurrentModification
+	})
+	assert.ErrorIs(t, err, ErrConcurrentModification)
+	assert.Equal(t, 1, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,274 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/hamidghavidel/txctx/dberr"
+)
+
+// ErrLockNotAvailable is matched by every *LockError.
+var ErrLockNotAvailable = errors.New("txctx: lock not available")
+
+// LockMode is the way the rows selected by `QueryLocked()` are locked.
+type LockMode int
+
+const (
+	// LockWait locks the rows for update, waiting for the transactions holding them.
+	LockWait LockMode = iota + 1
+	// LockNoWait locks the rows for update, and fails right away if one of them is locked.
+	LockNoWait
+	// LockSkipLocked locks the rows for update, skipping the rows locked by other transactions.
+	LockSkipLocked
+	// LockShared locks the rows in shared mode: other transactions can read them, but not update them.
+	LockShared
+)
+
+func (m LockMode) String() string {
+	switch m {
+	case LockWait:
+		return "wait"
+	case LockNoWait:
+		return "nowait"
+	case LockSkipLocked:
+		return "skip locked"
+	case LockShared:
+		return "shared"
+	}
+	return "unknown"
+}
+
+// LockError is returned when rows could not be locked, because they were locked by another
+// transaction and the mode doesn't wait, or because the lock wait timed out.
+type LockError struct {
+	Mode LockMode
+	// Err is the error returned by the driver.
+	Err error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("txctx: lock not available (%s): %v", e.Mode, e.Err)
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the error match `ErrLockNotAvailable`.
+func (e *LockError) Is(target error) bool {
+	return target == ErrLockNotAvailable
+}
+
+// WithDialect sets the dialect of the database, for the helpers generating SQL such as
+// `QueryLocked()`. Defaults to Postgres.
+func WithDialect(d Dialect) Option {
+	return func(s *SQLSession) {
+		s.dialect = d
+	}
+}
+
+// LockRows returns the SELECT query locking the rows it selects with the given mode.
+//
+// On Postgres and MySQL (8.0+), the locking clause is appended to the query. On SQL Server,
+// table hints are added to the first table of the FROM clause. SQLite has no row locks: the
+// query is returned as is, since the transaction locks the whole database once it writes.
+func (d Dialect) LockRows(query string, mode LockMode) (string, error) {
+	var clause string
+	switch mode {
+	case LockWait:
+		clause = "FOR UPDATE"
+	case LockNoWait:
+		clause = "FOR UPDATE NOWAIT"
+	case LockSkipLocked:
+		clause = "FOR UPDATE SKIP LOCKED"
+	case LockShared:
+		clause = "FOR SHARE"
+	default:
+		return "", fmt.Errorf("txctx: unknown lock mode %d", mode)
+	}
+
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	switch d {
+	case SQLite:
+		return query, nil
+	case SQLServer:
+		hints := map[LockMode]string{
+			LockWait:       "UPDLOCK, ROWLOCK",
+			LockNoWait:     "UPDLOCK, ROWLOCK, NOWAIT",
+			LockSkipLocked: "UPDLOCK, ROWLOCK, READPAST",
+			LockShared:     "HOLDLOCK, ROWLOCK",
+		}[mode]
+		i := tableEnd(query)
+		if i < 0 {
+			return "", fmt.Errorf("txctx: no table to lock in query %q", query)
+		}
+		return query[:i] + " WITH (" + hints + ")" + query[i:], nil
+	}
+	return query + " " + clause, nil
+}
+
+// QueryLocked runs the SELECT query in the transaction in the context, locking the rows it
+// selects with the given mode until the transaction ends. The query is written for the dialect
+// of the session, see `WithDialect()` and `Dialect.LockRows()`.
+//
+// If the rows cannot be locked, a *LockError matching `ErrLockNotAvailable` is returned.
+// `ErrNoTransaction` is returned if the context holds no transaction, since the locks would
+// be released as soon as the query completes.
+func QueryLocked(ctx context.Context, mode LockMode, query string, args ...any) (*sql.Rows, error) {
+	t, query, err := lockedQuery(ctx, mode, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := t.performer().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, lockError(mode, err)
+	}
+	return rows, nil
+}
+
+// QueryRowLocked runs the SELECT query like `QueryLocked()`, for a query returning at most one row.
+// If the row cannot be locked, its `Scan()` returns a *LockError matching `ErrLockNotAvailable`.
+func QueryRowLocked(ctx context.Context, mode LockMode, query string, args ...any) *Row {
+	t, query, err := lockedQuery(ctx, mode, query)
+	if err != nil {
+		return &Row{err: err}
+	}
+	return &Row{
+		row: t.performer().QueryRowContext(ctx, query, args...),
+		mapErr: func(err error) error {
+			return lockError(mode, err)
+		},
+	}
+}
+
+// lockedQuery returns the transaction in the context and the query locking the rows.
+func lockedQuery(ctx context.Context, mode LockMode, query string) (*transaction, string, error) {
+	t, err := current(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	d := t.dialect
+	if d == 0 {
+		d = Postgres
+	}
+	query, err = d.LockRows(query, mode)
+	return t, query, err
+}
+
+// performer returns the performer of the transaction, tracked like the one returned
+// by `SQLSession.QueryPerformer()`.
+func (t *transaction) performer() Performer {
+	var p Performer = t.tx
+	if t.watchdog != nil {
+		p = activityPerformer{Performer: p, txn: t}
+	}
+	if t.leaks != nil {
+		p = leakPerformer{Performer: p, leaks: t.leaks, owner: t.leakID}
+	}
+	return p
+}
+
+func lockError(mode LockMode, err error) error {
+	if dberr.IsLockTimeout(err) {
+		return &LockError{Mode: mode, Err: err}
+	}
+	return err
+}
+
+// tableEnd returns the position following the first table of the FROM clause of the query,
+// and its alias if any, or -1 if the query has no FROM clause.
+func tableEnd(query string) int {
+	i := fromClause(query)
+	if i < 0 {
+		return -1
+	}
+	i = skipSpaces(query, i)
+	end := identifierEnd(query, i)
+	if end == i {
+		return -1
+	}
+	next := skipSpaces(query, end)
+	word := identifierEnd(query, next)
+	switch keyword := strings.ToUpper(query[next:word]); {
+	case keyword == "AS":
+		aliasStart := skipSpaces(query, word)
+		return identifierEnd(query, aliasStart)
+	case word > next && !sqlKeywords[keyword]:
+		return word
+	}
+	return end
+}
+
+// sqlKeywords are the keywords that can follow the table of a FROM clause.
+var sqlKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"CROSS": true, "OUTER": true, "ON": true, "ORDER": true, "GROUP": true, "HAVING": true,
+	"OPTION": true, "UNION": true, "EXCEPT": true, "INTERSECT": true, "WITH": true, "FOR": true,
+}
+
+// fromClause returns the position following the FROM keyword of the query, outside of
+// quoted literals, identifiers and subqueries, or -1 if there is none.
+func fromClause(query string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (c == 'F' || c == 'f') && len(query) >= i+4 && strings.EqualFold(query[i:i+4], "FROM") &&
+			(i == 0 || !isIdentifier(rune(query[i-1]))) && (i+4 == len(query) || !isIdentifier(rune(query[i+4]))):
+			return i + 4
+		}
+	}
+	return -1
+}
+
+// identifierEnd returns the position following the possibly qualified and quoted identifier
+// starting at i.
+func identifierEnd(query string, i int) int {
+	for i < len(query) {
+		switch c := query[i]; {
+		case c == '[' || c == '"':
+			closing := byte(']')
+			if c == '"' {
+				closing = '"'
+			}
+			j := strings.IndexByte(query[i+1:], closing)
+			if j < 0 {
+				return len(query)
+			}
+			i += j + 2
+		case c == '.' || isIdentifier(rune(c)):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func skipSpaces(query string, i int) int {
+	for i < len(query) && unicode.IsSpace(rune(query[i])) {
+		i++
+	}
+	return i
+}
+
+func isIdentifier(r rune) bool {
+	return r == '_' || r == '#' || r == '@' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
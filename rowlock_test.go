@@ -0,0 +1,136 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockNotAvailableError mimics the errors of pgx.
+type lockNotAvailableError struct{}
+
+func (lockNotAvailableError) Error() string {
+	return `ERROR: could not obtain lock on row in relation "orders" (SQLSTATE 55P03)`
+}
+func (lockNotAvailableError) SQLState() string { return "55P03" }
+
+func TestDialect_LockRows(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		mode    LockMode
+		query   string
+		want    string
+	}{
+		{Postgres, LockWait, "SELECT id FROM orders WHERE id = $1", "SELECT id FROM orders WHERE id = $1 FOR UPDATE"},
+		{Postgres, LockNoWait, "SELECT id FROM orders WHERE id = $1;", "SELECT id FROM orders WHERE id = $1 FOR UPDATE NOWAIT"},
+		{Postgres, LockSkipLocked, "SELECT id FROM orders LIMIT 10", "SELECT id FROM orders LIMIT 10 FOR UPDATE SKIP LOCKED"},
+		{MySQL, LockShared, "SELECT id FROM orders", "SELECT id FROM orders FOR SHARE"},
+		{SQLite, LockNoWait, "SELECT id FROM orders", "SELECT id FROM orders"},
+		{SQLServer, LockWait, "SELECT id FROM orders WHERE id = @p1", "SELECT id FROM orders WITH (UPDLOCK, ROWLOCK) WHERE id = @p1"},
+		{SQLServer, LockNoWait, "SELECT o.id FROM dbo.orders o JOIN items i ON i.order_id = o.id", "SELECT o.id FROM dbo.orders o WITH (UPDLOCK, ROWLOCK, NOWAIT) JOIN items i ON i.order_id = o.id"},
+		{SQLServer, LockSkipLocked, "SELECT TOP 10 id FROM [queue jobs] AS j ORDER BY id", "SELECT TOP 10 id FROM [queue jobs] AS j WITH (UPDLOCK, ROWLOCK, READPAST) ORDER BY id"},
+		{SQLServer, LockShared, "select (SELECT COUNT(*) FROM items) AS n, 'from' FROM orders", "select (SELECT COUNT(*) FROM items) AS n, 'from' FROM orders WITH (HOLDLOCK, ROWLOCK)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect.String()+" "+tt.mode.String(), func(t *testing.T) {
+			got, err := tt.dialect.LockRows(tt.query, tt.mode)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := SQLServer.LockRows("SELECT 1", LockWait)
+	assert.Error(t, err)
+	_, err = Postgres.LockRows("SELECT 1", LockMode(0))
+	assert.Error(t, err)
+}
+
+func TestQueryLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithDialect(SQLServer))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM orders WITH (UPDLOCK, ROWLOCK, READPAST) WHERE status = @p1")).
+		WithArgs("pending").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit()
+
+	var ids []int
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		rows, err := QueryLocked(ctx, LockSkipLocked, "SELECT id FROM orders WHERE status = @p1", "pending")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryRowLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM orders WHERE id = $1 FOR UPDATE NOWAIT")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("pending"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM orders WHERE id = $1 FOR UPDATE NOWAIT")).
+		WithArgs(2).
+		WillReturnError(lockNotAvailableError{})
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM orders WHERE id = $1 FOR UPDATE NOWAIT")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}))
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+	defer child.Rollback()
+	ctx := child.Context()
+
+	var status string
+	require.NoError(t, QueryRowLocked(ctx, LockNoWait, "SELECT status FROM orders WHERE id = $1", 1).Scan(&status))
+	assert.Equal(t, "pending", status)
+
+	err = QueryRowLocked(ctx, LockNoWait, "SELECT status FROM orders WHERE id = $1", 2).Scan(&status)
+	assert.ErrorIs(t, err, ErrLockNotAvailable)
+	var lockErr *LockError
+	require.ErrorAs(t, err, &lockErr)
+	assert.Equal(t, LockNoWait, lockErr.Mode)
+	assert.ErrorIs(t, err, lockNotAvailableError{})
+
+	err = QueryRowLocked(ctx, LockNoWait, "SELECT status FROM orders WHERE id = $1", 3).Scan(&status)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, child.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryLocked_NoTransaction(t *testing.T) {
+	_, err := QueryLocked(context.Background(), LockWait, "SELECT id FROM orders")
+	assert.ErrorIs(t, err, ErrNoTransaction)
+
+	var status string
+	err = QueryRowLocked(context.Background(), LockWait, "SELECT status FROM orders").Scan(&status)
+	assert.ErrorIs(t, err, ErrNoTransaction)
+}
@@ -0,0 +1,401 @@
+// Package saga orchestrates workflows spanning several local transactions and external
+// calls, compensating the completed steps when one of them fails.
+//
+// Each step runs in its own transaction, in which the saga's progress and data are
+// persisted along with the step's writes. A step is therefore recorded as done if and
+// only if its writes are committed, and a crashed process can resume or compensate the
+// unfinished sagas at startup with `Orchestrator.Resume()`.
+//
+// Writes performed through `QueryPerformer()` run exactly once. External calls may be
+// repeated when a process crashes after the call but before the commit: they should be
+// made idempotent with the key returned by `StepKey()`.
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+var (
+	// ErrCompensated is returned when a step failed and every completed step was compensated.
+	ErrCompensated = errors.New("saga: compensated")
+
+	// ErrConflict is returned when the saga was advanced by another process.
+	ErrConflict = errors.New("saga: advanced concurrently")
+
+	// ErrNotFound is returned when the saga does not exist.
+	ErrNotFound = errors.New("saga: not found")
+)
+
+// Status of a saga.
+type Status string
+
+const (
+	// Running sagas are executing their steps.
+	Running Status = "running"
+	// Compensating sagas are compensating their completed steps after a failure.
+	Compensating Status = "compensating"
+	// Completed sagas executed all their steps.
+	Completed Status = "completed"
+	// Compensated sagas failed and compensated all their completed steps.
+	Compensated Status = "compensated"
+)
+
+// Step of a saga. The action and the compensation run in their own transaction, given
+// as a context, and may modify the saga's data, which is persisted in the same transaction.
+type Step[D any] struct {
+	Name string
+
+	// Action performs the step.
+	Action func(ctx context.Context, data *D) error
+
+	// Compensate undoes the step after a later step failed. It is optional.
+	// A failing compensation is retried by `Orchestrator.Resume()`.
+	Compensate func(ctx context.Context, data *D) error
+}
+
+// Definition of a saga.
+type Definition[D any] struct {
+	// Name identifies the definition. It is persisted with every saga.
+	Name  string
+	Steps []Step[D]
+}
+
+// Instance is the persisted state of a saga.
+type Instance[D any] struct {
+	ID     string
+	Status Status
+	// Step is the number of steps completed and not compensated.
+	Step int
+	Data D
+	// Error is the message of the error that made the saga compensate.
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// EventKind identifies an event of a saga's execution.
+type EventKind int
+
+const (
+	StepCompleted EventKind = iota + 1
+	StepFailed
+	StepCompensated
+	CompensationFailed
+	SagaCompleted
+	SagaCompensated
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case StepCompleted:
+		return "step completed"
+	case StepFailed:
+		return "step failed"
+	case StepCompensated:
+		return "step compensated"
+	case CompensationFailed:
+		return "compensation failed"
+	case SagaCompleted:
+		return "saga completed"
+	case SagaCompensated:
+		return "saga compensated"
+	}
+	return "unknown"
+}
+
+// Event of a saga's execution.
+type Event struct {
+	Kind EventKind
+	Saga string
+	ID   string
+	// Step is the name of the step, empty for saga-wide events.
+	Step string
+	Err  error
+}
+
+// Config of an orchestrator.
+type Config struct {
+	// Dialect of the database. Defaults to Postgres.
+	Dialect txctx.Dialect
+
+	// Table holding the sagas. Defaults to "sagas".
+	Table string
+
+	// OnEvent is called after every step and once the saga is done.
+	OnEvent func(Event)
+}
+
+// Orchestrator executes the sagas of a definition.
+type Orchestrator[D any] struct {
+	session txctx.Session
+	def     Definition[D]
+	cfg     Config
+	now     func() time.Time
+}
+
+// New creates an orchestrator for the given definition.
+func New[D any](session txctx.Session, def Definition[D], cfg Config) *Orchestrator[D] {
+	if cfg.Dialect == 0 {
+		cfg.Dialect = txctx.Postgres
+	}
+	if cfg.Table == "" {
+		cfg.Table = "sagas"
+	}
+	return &Orchestrator[D]{
+		session: session,
+		def:     def,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+type stepKey struct{}
+
+// StepKey returns a key identifying the step being executed or compensated, to be used
+// as an idempotency key for external calls. The key of a compensation is the key of its
+// step followed by "/compensate", so that a provider doesn't take the refund of a charge
+// for a retry of the charge. It returns an empty string outside a step.
+func StepKey(ctx context.Context) string {
+	key, _ := ctx.Value(stepKey{}).(string)
+	return key
+}
+
+// Start persists a new saga with the given ID and data, and executes it.
+//
+// If a step fails, the completed steps are compensated in reverse order and the returned
+// error wraps both `ErrCompensated` and the step's error. If a compensation fails, the
+// saga remains in the compensating status and the compensation is retried by `Resume()`.
+func (o *Orchestrator[D]) Start(ctx context.Context, id string, data D) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("saga: cannot serialize data: %w", err)
+	}
+	now := o.now().UTC()
+	_, err = o.session.QueryPerformer(ctx).ExecContext(ctx,
+		o.query("INSERT INTO %s (id, name, status, step, data, error, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"),
+		id, o.def.Name, Running, 0, payload, "", now, now,
+	)
+	if err != nil {
+		return err
+	}
+	return o.execute(ctx, &Instance[D]{ID: id, Status: Running, Data: data, CreatedAt: now, UpdatedAt: now})
+}
+
+// Run resumes the saga with the given ID where it stopped. It is a no-op for sagas that are done.
+func (o *Orchestrator[D]) Run(ctx context.Context, id string) error {
+	inst, err := o.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return o.execute(ctx, inst)
+}
+
+// Resume resumes every unfinished saga of the definition, typically at startup.
+func (o *Orchestrator[D]) Resume(ctx context.Context) error {
+	rows, err := o.session.QueryPerformer(ctx).QueryContext(ctx,
+		o.query("SELECT id FROM %s WHERE name = ? AND status IN (?, ?) ORDER BY created_at"),
+		o.def.Name, Running, Compensating,
+	)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range ids {
+		if err := o.Run(ctx, id); err != nil && !errors.Is(err, ErrCompensated) {
+			errs = append(errs, fmt.Errorf("saga %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Get returns the persisted state of the saga with the given ID.
+func (o *Orchestrator[D]) Get(ctx context.Context, id string) (*Instance[D], error) {
+	inst := &Instance[D]{ID: id}
+	var payload []byte
+	err := o.session.QueryPerformer(ctx).QueryRowContext(ctx,
+		o.query("SELECT status, step, data, error, created_at, updated_at FROM %s WHERE id = ? AND name = ?"),
+		id, o.def.Name,
+	).Scan(&inst.Status, &inst.Step, &payload, &inst.Error, &inst.CreatedAt, &inst.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(payload, &inst.Data); err != nil {
+		return nil, fmt.Errorf("saga: cannot deserialize data: %w", err)
+	}
+	return inst, nil
+}
+
+func (o *Orchestrator[D]) execute(ctx context.Context, inst *Instance[D]) error {
+	if inst.Status == Running {
+		err := o.forward(ctx, inst)
+		if err == nil || errors.Is(err, ErrConflict) {
+			return err
+		}
+		if err := o.fail(ctx, inst, err); err != nil {
+			return err
+		}
+		return o.compensate(ctx, inst, err)
+	}
+	if inst.Status == Compensating {
+		return o.compensate(ctx, inst, errors.New(inst.Error))
+	}
+	return nil
+}
+
+// forward executes the remaining steps.
+func (o *Orchestrator[D]) forward(ctx context.Context, inst *Instance[D]) error {
+	for inst.Step < len(o.def.Steps) {
+		step := o.def.Steps[inst.Step]
+		data := inst.Data
+		status := Running
+		if inst.Step+1 == len(o.def.Steps) {
+			status = Completed
+		}
+
+		var failed error
+		err := o.session.Transaction(o.stepContext(ctx, inst.ID, step.Name, false), func(ctx context.Context) error {
+			if failed = step.Action(ctx, &data); failed != nil {
+				return failed
+			}
+			return o.advance(ctx, inst, status, inst.Step+1, data, "")
+		})
+		if err != nil {
+			if failed != nil {
+				err = fmt.Errorf("step %q: %w", step.Name, failed)
+			}
+			if !errors.Is(err, ErrConflict) {
+				o.emit(Event{Kind: StepFailed, Saga: o.def.Name, ID: inst.ID, Step: step.Name, Err: err})
+			}
+			return err
+		}
+
+		inst.Status, inst.Step, inst.Data = status, inst.Step+1, data
+		o.emit(Event{Kind: StepCompleted, Saga: o.def.Name, ID: inst.ID, Step: step.Name})
+	}
+	o.emit(Event{Kind: SagaCompleted, Saga: o.def.Name, ID: inst.ID})
+	return nil
+}
+
+// fail switches the saga to the compensating status after a step failed.
+func (o *Orchestrator[D]) fail(ctx context.Context, inst *Instance[D], cause error) error {
+	err := o.session.Transaction(ctx, func(ctx context.Context) error {
+		return o.advance(ctx, inst, Compensating, inst.Step, inst.Data, cause.Error())
+	})
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	inst.Status, inst.Error = Compensating, cause.Error()
+	return nil
+}
+
+// compensate compensates the completed steps in reverse order, after the given failure.
+func (o *Orchestrator[D]) compensate(ctx context.Context, inst *Instance[D], cause error) error {
+	for inst.Step > 0 {
+		step := o.def.Steps[inst.Step-1]
+		data := inst.Data
+		status := Compensating
+		if inst.Step == 1 {
+			status = Compensated
+		}
+
+		err := o.session.Transaction(o.stepContext(ctx, inst.ID, step.Name, true), func(ctx context.Context) error {
+			if step.Compensate != nil {
+				if err := step.Compensate(ctx, &data); err != nil {
+					return err
+				}
+			}
+			return o.advance(ctx, inst, status, inst.Step-1, data, inst.Error)
+		})
+		if err != nil {
+			if !errors.Is(err, ErrConflict) {
+				o.emit(Event{Kind: CompensationFailed, Saga: o.def.Name, ID: inst.ID, Step: step.Name, Err: err})
+			}
+			return fmt.Errorf("saga: compensation of step %q failed: %w", step.Name, err)
+		}
+
+		inst.Status, inst.Step, inst.Data = status, inst.Step-1, data
+		o.emit(Event{Kind: StepCompensated, Saga: o.def.Name, ID: inst.ID, Step: step.Name})
+	}
+	if inst.Status != Compensated {
+		// The saga failed before completing any step.
+		err := o.session.Transaction(ctx, func(ctx context.Context) error {
+			return o.advance(ctx, inst, Compensated, 0, inst.Data, inst.Error)
+		})
+		if err != nil {
+			return err
+		}
+		inst.Status = Compensated
+	}
+	o.emit(Event{Kind: SagaCompensated, Saga: o.def.Name, ID: inst.ID, Err: cause})
+	return fmt.Errorf("%w: %w", ErrCompensated, cause)
+}
+
+// advance persists the progress of the saga, provided it was not advanced by another process.
+func (o *Orchestrator[D]) advance(ctx context.Context, inst *Instance[D], status Status, step int, data D, msg string) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("saga: cannot serialize data: %w", err)
+	}
+	res, err := o.session.QueryPerformer(ctx).ExecContext(ctx,
+		o.query("UPDATE %s SET status = ?, step = ?, data = ?, error = ?, updated_at = ? WHERE id = ? AND status = ? AND step = ?"),
+		status, step, payload, msg, o.now().UTC(), inst.ID, inst.Status, inst.Step,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return fmt.Errorf("%w: %s", ErrConflict, inst.ID)
+	}
+	return nil
+}
+
+// stepContext names the transaction of the step or of its compensation, and identifies it
+// for `StepKey()`.
+func (o *Orchestrator[D]) stepContext(ctx context.Context, id, step string, compensation bool) context.Context {
+	name, key := o.def.Name+"/"+step, o.def.Name+"/"+id+"/"+step
+	if compensation {
+		name, key = name+"/compensate", key+"/compensate"
+	}
+	return context.WithValue(txctx.WithName(ctx, name), stepKey{}, key)
+}
+
+func (o *Orchestrator[D]) emit(evt Event) {
+	if o.cfg.OnEvent != nil {
+		o.cfg.OnEvent(evt)
+	}
+}
+
+// query formats the query with the table name and rebinds its placeholders.
+func (o *Orchestrator[D]) query(query string) string {
+	return o.cfg.Dialect.Rebind(fmt.Sprintf(query, o.cfg.Table))
+}
@@ -0,0 +1,280 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+type order struct {
+	ID       string `json:"id"`
+	Reserved bool   `json:"reserved"`
+	Charged  bool   `json:"charged"`
+}
+
+const updateQuery = "UPDATE sagas SET status = $1, step = $2, data = $3, error = $4, updated_at = $5 WHERE id = $6 AND status = $7 AND step = $8"
+
+func newTestOrchestrator(t *testing.T, def Definition[order], cfg Config) (*Orchestrator[order], sqlmock.Sqlmock) {
+	session, mock := txtest.Session(t)
+	o := New(session, def, cfg)
+	o.now = txtest.Clock
+	return o, mock
+}
+
+// orderSaga reserves the stock then charges the customer, failing the charge if asked to.
+func orderSaga(session func() txctx.Session, chargeErr error) Definition[order] {
+	return Definition[order]{
+		Name: "order",
+		Steps: []Step[order]{
+			{
+				Name: "reserve",
+				Action: func(ctx context.Context, o *order) error {
+					_, err := session().QueryPerformer(ctx).ExecContext(ctx, "UPDATE stock SET reserved = reserved + 1")
+					o.Reserved = err == nil
+					return err
+				},
+				Compensate: func(ctx context.Context, o *order) error {
+					_, err := session().QueryPerformer(ctx).ExecContext(ctx, "UPDATE stock SET reserved = reserved - 1")
+					o.Reserved = err != nil
+					return err
+				},
+			},
+			{
+				Name: "charge",
+				Action: func(ctx context.Context, o *order) error {
+					o.Charged = chargeErr == nil
+					return chargeErr
+				},
+			},
+		},
+	}
+}
+
+func newOrderOrchestrator(t *testing.T, chargeErr error, events *[]Event) (*Orchestrator[order], sqlmock.Sqlmock) {
+	var o *Orchestrator[order]
+	cfg := Config{OnEvent: func(evt Event) { *events = append(*events, evt) }}
+	o, mock := newTestOrchestrator(t, orderSaga(func() txctx.Session { return o.session }, chargeErr), cfg)
+	return o, mock
+}
+
+func expectUpdate(mock sqlmock.Sqlmock, status Status, step int, data, msg string, from Status, fromStep int) *sqlmock.ExpectedExec {
+	return mock.ExpectExec(regexp.QuoteMeta(updateQuery)).
+		WithArgs(status, step, []byte(data), msg, txtest.Now, "o-1", from, fromStep)
+}
+
+func kinds(events []Event) []EventKind {
+	var kinds []EventKind
+	for _, evt := range events {
+		kinds = append(kinds, evt.Kind)
+	}
+	return kinds
+}
+
+func TestOrchestrator_Start_Completes(t *testing.T) {
+	var events []Event
+	o, mock := newOrderOrchestrator(t, nil, &events)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sagas (id, name, status, step, data, error, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)")).
+		WithArgs("o-1", "order", Running, 0, []byte(`{"id":"o-1","reserved":false,"charged":false}`), "", txtest.Now, txtest.Now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE stock").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUpdate(mock, Running, 1, `{"id":"o-1","reserved":true,"charged":false}`, "", Running, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectUpdate(mock, Completed, 2, `{"id":"o-1","reserved":true,"charged":true}`, "", Running, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, o.Start(context.Background(), "o-1", order{ID: "o-1"}))
+	assert.Equal(t, []EventKind{StepCompleted, StepCompleted, SagaCompleted}, kinds(events))
+	assert.Equal(t, "reserve", events[0].Step)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrchestrator_Start_Compensates(t *testing.T) {
+	var events []Event
+	declined := errors.New("card declined")
+	o, mock := newOrderOrchestrator(t, declined, &events)
+
+	mock.ExpectExec("INSERT INTO sagas").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE stock").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUpdate(mock, Running, 1, `{"id":"o-1","reserved":true,"charged":false}`, "", Running, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	expectUpdate(mock, Compensating, 1, `{"id":"o-1","reserved":true,"charged":false}`, `step "charge": card declined`, Running, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE stock").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUpdate(mock, Compensated, 0, `{"id":"o-1","reserved":false,"charged":false}`, `step "charge": card declined`, Compensating, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := o.Start(context.Background(), "o-1", order{ID: "o-1"})
+	assert.ErrorIs(t, err, ErrCompensated)
+	assert.ErrorIs(t, err, declined)
+	assert.Equal(t, []EventKind{StepCompleted, StepFailed, StepCompensated, SagaCompensated}, kinds(events))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrchestrator_CompensationFailure_Resumed(t *testing.T) {
+	var events []Event
+	o, mock := newOrderOrchestrator(t, nil, &events)
+	stockErr := errors.New("stock unavailable")
+	data := `{"id":"o-1","reserved":true,"charged":false}`
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status, step, data, error, created_at, updated_at FROM sagas WHERE id = $1 AND name = $2")).
+		WithArgs("o-1", "order").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "step", "data", "error", "created_at", "updated_at"}).
+			AddRow(Compensating, 1, []byte(data), "card declined", txtest.Now, txtest.Now))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE stock").WillReturnError(stockErr)
+	mock.ExpectRollback()
+
+	err := o.Run(context.Background(), "o-1")
+	assert.ErrorIs(t, err, stockErr)
+	assert.NotErrorIs(t, err, ErrCompensated)
+	assert.Equal(t, []EventKind{CompensationFailed}, kinds(events))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM sagas WHERE name = $1 AND status IN ($2, $3) ORDER BY created_at")).
+		WithArgs("order", Running, Compensating).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("o-1"))
+	mock.ExpectQuery("SELECT status, step, data, error, created_at, updated_at FROM sagas").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "step", "data", "error", "created_at", "updated_at"}).
+			AddRow(Compensating, 1, []byte(data), "card declined", txtest.Now, txtest.Now))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE stock").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUpdate(mock, Compensated, 0, `{"id":"o-1","reserved":false,"charged":false}`, "card declined", Compensating, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, o.Resume(context.Background()))
+	assert.Equal(t, []EventKind{CompensationFailed, StepCompensated, SagaCompensated}, kinds(events))
+	assert.EqualError(t, events[2].Err, "card declined")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrchestrator_Run_ResumesForward(t *testing.T) {
+	var events []Event
+	o, mock := newOrderOrchestrator(t, nil, &events)
+
+	mock.ExpectQuery("SELECT status, step, data, error, created_at, updated_at FROM sagas").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "step", "data", "error", "created_at", "updated_at"}).
+			AddRow(Running, 1, []byte(`{"id":"o-1","reserved":true}`), "", txtest.Now, txtest.Now))
+	mock.ExpectBegin()
+	expectUpdate(mock, Completed, 2, `{"id":"o-1","reserved":true,"charged":true}`, "", Running, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, o.Run(context.Background(), "o-1"))
+	assert.Equal(t, []EventKind{StepCompleted, SagaCompleted}, kinds(events))
+	assert.Equal(t, "charge", events[0].Step)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrchestrator_Run_Done(t *testing.T) {
+	var events []Event
+	o, mock := newOrderOrchestrator(t, nil, &events)
+
+	mock.ExpectQuery("SELECT status, step, data, error, created_at, updated_at FROM sagas").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "step", "data", "error", "created_at", "updated_at"}).
+			AddRow(Completed, 2, []byte(`{}`), "", txtest.Now, txtest.Now))
+
+	require.NoError(t, o.Run(context.Background(), "o-1"))
+	assert.Empty(t, events)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrchestrator_Conflict(t *testing.T) {
+	var events []Event
+	o, mock := newOrderOrchestrator(t, nil, &events)
+
+	mock.ExpectQuery("SELECT status, step, data, error, created_at, updated_at FROM sagas").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "step", "data", "error", "created_at", "updated_at"}).
+			AddRow(Running, 0, []byte(`{"id":"o-1"}`), "", txtest.Now, txtest.Now))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE stock").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUpdate(mock, Running, 1, `{"id":"o-1","reserved":true,"charged":false}`, "", Running, 0).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := o.Run(context.Background(), "o-1")
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Empty(t, events)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrchestrator_Get_NotFound(t *testing.T) {
+	o, mock := newTestOrchestrator(t, Definition[order]{Name: "order"}, Config{})
+
+	mock.ExpectQuery("SELECT status, step, data, error, created_at, updated_at FROM sagas").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "step", "data", "error", "created_at", "updated_at"}))
+
+	_, err := o.Get(context.Background(), "o-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStepKey(t *testing.T) {
+	var keys []string
+	def := Definition[order]{
+		Name: "order",
+		Steps: []Step[order]{
+			{
+				Name: "charge",
+				Action: func(ctx context.Context, o *order) error {
+					keys = append(keys, StepKey(ctx))
+					return nil
+				},
+				Compensate: func(ctx context.Context, o *order) error {
+					keys = append(keys, StepKey(ctx))
+					return nil
+				},
+			},
+			{
+				Name: "ship",
+				Action: func(ctx context.Context, o *order) error {
+					return errors.New("address not served")
+				},
+			},
+		},
+	}
+	o, mock := newTestOrchestrator(t, def, Config{Dialect: txctx.SQLite})
+
+	mock.ExpectExec("INSERT INTO sagas").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE sagas").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE sagas").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	err := o.Start(context.Background(), "o-1", order{})
+	assert.ErrorIs(t, err, ErrCompensated)
+	assert.Equal(t, []string{"order/o-1/charge", "order/o-1/charge/compensate"}, keys)
+	assert.Empty(t, StepKey(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEventKind_String(t *testing.T) {
+	assert.Equal(t, "step compensated", StepCompensated.String())
+	assert.Equal(t, "unknown", EventKind(0).String())
+}
@@ -0,0 +1,64 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+// Schema returns the statements creating the table of sagas for the given dialect.
+func Schema(d txctx.Dialect, table string) []string {
+	switch d {
+	case txctx.MySQL:
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	step INT NOT NULL,
+	data LONGBLOB NOT NULL,
+	error TEXT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	updated_at DATETIME(6) NOT NULL,
+	INDEX %[1]s_name_status (name, status)
+)`, table)}
+	case txctx.SQLite:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT NOT NULL PRIMARY KEY,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL,
+	step INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	error TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`, table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_name_status ON %[1]s (name, status)", table),
+		}
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	step INTEGER NOT NULL,
+	data BYTEA NOT NULL,
+	error TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_name_status ON %[1]s (name, status)", table),
+	}
+}
+
+// CreateTable creates the table of sagas if it doesn't exist.
+func (o *Orchestrator[D]) CreateTable(ctx context.Context) error {
+	p := o.session.QueryPerformer(ctx)
+	for _, stmt := range Schema(o.cfg.Dialect, o.cfg.Table) {
+		if _, err := p.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
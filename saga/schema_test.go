@@ -0,0 +1,73 @@
+package saga
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+	"github.com/hamidghavidel/txctx/internal/txtest"
+)
+
+func TestSchema(t *testing.T) {
+	tests := []struct {
+		dialect txctx.Dialect
+		defs    []string
+		indexes []string
+	}{
+		{
+			dialect: txctx.Postgres,
+			defs: []string{
+				"id VARCHAR(255) NOT NULL PRIMARY KEY",
+				"step INTEGER NOT NULL",
+				"data BYTEA NOT NULL",
+				"updated_at TIMESTAMPTZ NOT NULL",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS sagas_name_status ON sagas (name, status)"},
+		},
+		{
+			// MySQL has no CREATE INDEX IF NOT EXISTS, the index is declared with the table.
+			dialect: txctx.MySQL,
+			defs: []string{
+				"id VARCHAR(255) NOT NULL PRIMARY KEY",
+				"step INT NOT NULL",
+				"data LONGBLOB NOT NULL",
+				"updated_at DATETIME(6) NOT NULL",
+				"INDEX sagas_name_status (name, status)",
+			},
+		},
+		{
+			dialect: txctx.SQLite,
+			defs: []string{
+				"id TEXT NOT NULL PRIMARY KEY",
+				"step INTEGER NOT NULL",
+				"data BLOB NOT NULL",
+				"updated_at TIMESTAMP NOT NULL",
+			},
+			indexes: []string{"CREATE INDEX IF NOT EXISTS sagas_name_status ON sagas (name, status)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			stmts := Schema(tt.dialect, "sagas")
+			require.Len(t, stmts, 1+len(tt.indexes))
+			assert.Subset(t, txtest.Definitions(stmts[0]), tt.defs)
+			for i, index := range tt.indexes {
+				assert.Equal(t, index, stmts[1+i])
+			}
+		})
+	}
+}
+
+func TestOrchestrator_CreateTable(t *testing.T) {
+	o, mock := newTestOrchestrator(t, Definition[order]{Name: "order"}, Config{Dialect: txctx.MySQL, Table: "orders"})
+	mock.ExpectExec(`(?s)^CREATE TABLE IF NOT EXISTS orders \(.*data LONGBLOB NOT NULL,.*INDEX orders_name_status \(name, status\)\s*\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, o.CreateTable(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,159 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+type savepointKey struct{}
+
+// savepoint is a savepoint of a transaction.
+type savepoint struct {
+	txn    *transaction
+	parent *savepoint
+	hooks  hookSet
+	closed bool
+}
+
+// Savepoint executes the function within a savepoint of the transaction in the context.
+// If the function returns an error, the changes it made are rolled back to the savepoint
+// and the error is returned, but the transaction stays usable. Otherwise, the savepoint is released.
+//
+// Functions registered with `BeforeCommit()` and `AfterCommit()` inside the savepoint are
+// discarded if it is rolled back, and functions registered with `AfterRollback()` are called.
+// Savepoints can be nested. `ErrNoTransaction` is returned if the context holds no transaction.
+//
+// The statements are written for the dialect of the session, see `WithDialect()`. SQL Server
+// has no statement releasing a savepoint: it is left in place until the transaction ends.
+func Savepoint(ctx context.Context, f func(ctx context.Context) error) error {
+	t, err := current(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.hooks.mu.Lock()
+	sp := &savepoint{txn: t, parent: innermost(ctx, t)}
+	t.hooks.savepoints = append(t.hooks.savepoints, sp)
+	t.hooks.seq++
+	name := "txctx_sp_" + strconv.Itoa(t.hooks.seq)
+	t.hooks.mu.Unlock()
+
+	create, release, rollback := t.dialect.savepointStmts(name)
+	t.touch()
+	if _, err := t.tx.ExecContext(ctx, create); err != nil {
+		t.closeSavepoint(ctx, sp, false)
+		return err
+	}
+	ctx = context.WithValue(ctx, savepointKey{}, sp)
+	t.hooks.mu.Lock()
+	fs := slices.Clone(t.hooks.onSavepoint)
+	t.hooks.mu.Unlock()
+	for _, start := range fs {
+		start(ctx)
+	}
+	err = f(ctx)
+	if err == nil && release != "" {
+		t.touch()
+		_, err = t.tx.ExecContext(ctx, release)
+	}
+	if err == nil {
+		t.closeSavepoint(ctx, sp, true)
+		return nil
+	}
+	t.touch()
+	if _, rollbackErr := t.tx.ExecContext(context.WithoutCancel(ctx), rollback); rollbackErr != nil {
+		err = errors.Join(err, rollbackErr)
+	}
+	t.closeSavepoint(ctx, sp, false)
+	return err
+}
+
+// savepointStmts returns the statements creating, releasing and rolling back to the savepoint.
+// The release statement is empty on SQL Server, which has none.
+func (d Dialect) savepointStmts(name string) (create, release, rollback string) {
+	if d == SQLServer {
+		return "SAVE TRANSACTION " + name, "", "ROLLBACK TRANSACTION " + name
+	}
+	return "SAVEPOINT " + name, "RELEASE SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name
+}
+
+// OnSavepoint registers a function called when a savepoint of the transaction in the context
+// starts, with the context of the savepoint. The function can save state and register a function
+// restoring it with `AfterRollback()`, called if the savepoint is rolled back.
+//
+// The function is registered on the transaction itself, even within a savepoint, and is called
+// for every savepoint until the transaction ends. `ErrNoTransaction` is returned if the context
+// holds no transaction.
+func OnSavepoint(ctx context.Context, f func(ctx context.Context)) error {
+	t, err := current(ctx)
+	if err != nil {
+		return err
+	}
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	t.hooks.onSavepoint = append(t.hooks.onSavepoint, f)
+	return nil
+}
+
+// WithoutSavepoint returns a copy of the context in which `BeforeCommit()`, `AfterCommit()` and
+// `AfterRollback()` register their functions on the transaction itself, even within a savepoint.
+// It is meant for the functions serving values that live as long as the transaction, such as
+// the values returned by `Attach()`, which would otherwise be dropped with a savepoint rolled
+// back while the value is still in use. The context must only be used to register functions.
+func WithoutSavepoint(ctx context.Context) context.Context {
+	return context.WithValue(ctx, savepointKey{}, nil)
+}
+
+// innermost returns the innermost savepoint of the transaction in progress in the context.
+// The caller must hold the hooks' lock.
+func innermost(ctx context.Context, t *transaction) *savepoint {
+	sp, _ := ctx.Value(savepointKey{}).(*savepoint)
+	if sp != nil && sp.txn != t {
+		return nil
+	}
+	return open(sp)
+}
+
+// open returns the savepoint or its closest ancestor still in progress.
+func open(sp *savepoint) *savepoint {
+	for sp != nil && sp.closed {
+		sp = sp.parent
+	}
+	return sp
+}
+
+// closeSavepoint hands the functions registered in a released savepoint over to its parent,
+// or calls the rollback functions of a savepoint rolled back.
+func (t *transaction) closeSavepoint(ctx context.Context, sp *savepoint, released bool) {
+	t.hooks.mu.Lock()
+	if t.hooks.done {
+		// The transaction ended while the savepoint was in progress.
+		t.hooks.mu.Unlock()
+		return
+	}
+	sp.closed = true
+	for i, other := range t.hooks.savepoints {
+		if other == sp {
+			t.hooks.savepoints = append(t.hooks.savepoints[:i], t.hooks.savepoints[i+1:]...)
+			break
+		}
+	}
+	if released {
+		if parent := open(sp.parent); parent != nil {
+			parent.hooks.merge(sp.hooks)
+		} else {
+			t.hooks.merge(sp.hooks)
+		}
+		t.hooks.mu.Unlock()
+		return
+	}
+	fs := sp.hooks.afterRollback
+	t.hooks.mu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	for _, f := range fs {
+		f(ctx)
+	}
+}
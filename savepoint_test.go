@@ -0,0 +1,224 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavepoint_Release(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	var calls []string
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return Savepoint(ctx, func(ctx context.Context) error {
+			require.NoError(t, AfterCommit(ctx, func(ctx context.Context) {
+				calls = append(calls, "after commit")
+			}))
+			_, err := session.QueryPerformer(ctx).ExecContext(ctx, "INSERT INTO users (email) VALUES (?)", "test@example.com")
+			return err
+		})
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"after commit"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavepoint_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	bodyErr := errors.New("duplicate profile")
+	var calls []string
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT txctx_sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		require.NoError(t, AfterCommit(ctx, func(ctx context.Context) {
+			calls = append(calls, "outer commit")
+		}))
+		return Savepoint(ctx, func(ctx context.Context) error {
+			require.NoError(t, AfterCommit(ctx, func(ctx context.Context) {
+				calls = append(calls, "savepoint commit")
+			}))
+			err := Savepoint(ctx, func(ctx context.Context) error {
+				require.NoError(t, BeforeCommit(ctx, func(ctx context.Context) error {
+					calls = append(calls, "nested before commit")
+					return nil
+				}))
+				require.NoError(t, AfterCommit(ctx, func(ctx context.Context) {
+					calls = append(calls, "nested commit")
+				}))
+				require.NoError(t, AfterRollback(ctx, func(ctx context.Context) {
+					calls = append(calls, "nested rollback")
+				}))
+				return bodyErr
+			})
+			assert.ErrorIs(t, err, bodyErr)
+			return nil
+		})
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nested rollback", "outer commit", "savepoint commit"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavepoint_SQLServer(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil, WithDialect(SQLServer))
+	bodyErr := errors.New("duplicate profile")
+
+	// SQL Server has no release: the outer savepoint is kept until the commit.
+	mock.ExpectBegin()
+	mock.ExpectExec("^SAVE TRANSACTION txctx_sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^SAVE TRANSACTION txctx_sp_2$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^ROLLBACK TRANSACTION txctx_sp_2$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		return Savepoint(ctx, func(ctx context.Context) error {
+			err := Savepoint(ctx, func(ctx context.Context) error {
+				return bodyErr
+			})
+			assert.ErrorIs(t, err, bodyErr)
+			return nil
+		})
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOnSavepoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	var calls []string
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT txctx_sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		n := 0
+		require.NoError(t, OnSavepoint(ctx, func(ctx context.Context) {
+			n++
+			name := fmt.Sprintf("savepoint %d", n)
+			calls = append(calls, name)
+			require.NoError(t, AfterRollback(ctx, func(ctx context.Context) {
+				calls = append(calls, name+" rolled back")
+			}))
+		}))
+		require.NoError(t, Savepoint(ctx, func(ctx context.Context) error {
+			return nil
+		}))
+		assert.Error(t, Savepoint(ctx, func(ctx context.Context) error {
+			return errors.New("rolled back")
+		}))
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"savepoint 1", "savepoint 2", "savepoint 2 rolled back"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithoutSavepoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	var calls []string
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		err := Savepoint(ctx, func(ctx context.Context) error {
+			require.NoError(t, BeforeCommit(WithoutSavepoint(ctx), func(ctx context.Context) error {
+				calls = append(calls, "before commit")
+				return nil
+			}))
+			require.NoError(t, AfterCommit(ctx, func(ctx context.Context) {
+				calls = append(calls, "savepoint commit")
+			}))
+			return errors.New("rolled back")
+		})
+		assert.Error(t, err)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"before commit"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavepoint_TransactionRolledBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	var calls []string
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	err = Savepoint(child.Context(), func(ctx context.Context) error {
+		require.NoError(t, AfterRollback(ctx, func(ctx context.Context) {
+			calls = append(calls, "savepoint rollback")
+		}))
+		return child.Rollback()
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"savepoint rollback"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavepoint_NoTransaction(t *testing.T) {
+	err := Savepoint(context.Background(), func(ctx context.Context) error {
+		t.Fatal("the function must not run")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrNoTransaction)
+}
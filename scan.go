@@ -0,0 +1,227 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryOne runs the query with the performer and scans its first row into a T.
+// `sql.ErrNoRows` is returned if the query returns no row.
+//
+// If T is a struct, or a pointer to a struct, the columns are mapped to its fields by name: the
+// name set with a `db` tag, or the lowercased field name. A `db:"-"` tag ignores the field.
+// The fields of embedded structs are mapped as if they belonged to T. Columns without a field
+// are an error. Fields can be of any type supported by `sql.Rows.Scan()`, including pointers
+// and sql.Null types for nullable columns, and types implementing sql.Scanner.
+//
+// Other types, as well as structs implementing sql.Scanner and time.Time, receive the only column
+// of the row.
+func QueryOne[T any](ctx context.Context, p Performer, query string, args ...any) (T, error) {
+	rows, err := p.QueryContext(ctx, query, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	values, err := scanRows[T](rows, 1)
+	if err != nil || len(values) == 0 {
+		var zero T
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return zero, err
+	}
+	return values[0], nil
+}
+
+// QueryAll runs the query with the performer and scans all its rows into Ts, mapped like
+// in `QueryOne()`. An empty slice is returned if the query returns no row.
+func QueryAll[T any](ctx context.Context, p Performer, query string, args ...any) ([]T, error) {
+	rows, err := p.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows[T](rows, 0)
+}
+
+// QueryScalar runs a query returning a single value, such as a count, and scans it into a T.
+// `sql.ErrNoRows` is returned if the query returns no row.
+func QueryScalar[T any](ctx context.Context, p Performer, query string, args ...any) (T, error) {
+	var v T
+	if err := p.QueryRowContext(ctx, query, args...).Scan(&v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// ExecReturning executes a statement returning a row, such as an INSERT with a RETURNING clause,
+// and scans the returned row into a T, mapped like in `QueryOne()`. `sql.ErrNoRows` is returned
+// if the statement returns no row, for instance an UPDATE that matched none.
+// Use `QueryAll()` for statements returning several rows.
+func ExecReturning[T any](ctx context.Context, p Performer, query string, args ...any) (T, error) {
+	return QueryOne[T](ctx, p, query, args...)
+}
+
+// scanRows scans at most limit rows, or all of them if limit is 0, and closes them.
+func scanRows[T any](rows *sql.Rows, limit int) ([]T, error) {
+	defer rows.Close()
+
+	scan, err := rowScanner[T](rows)
+	if err != nil {
+		return nil, err
+	}
+	values := []T{}
+	for rows.Next() {
+		v, err := scan()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if len(values) == limit {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return values, rows.Close()
+}
+
+// rowScanner returns a function scanning the current row into a T.
+func rowScanner[T any](rows *sql.Rows) (func() (T, error), error) {
+	typ := reflect.TypeFor[T]()
+	base := typ
+	if typ.Kind() == reflect.Pointer && isMapped(typ.Elem()) {
+		base = typ.Elem()
+	}
+	var paths [][]int
+	if isMapped(base) {
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		if paths, err = columnPaths(base, columns); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() (T, error) {
+		v := reflect.New(base)
+		dest := []any{v.Interface()}
+		if paths != nil {
+			dest = destinations(v.Elem(), paths)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			var zero T
+			return zero, err
+		}
+		if base != typ {
+			return v.Interface().(T), nil
+		}
+		return v.Elem().Interface().(T), nil
+	}, nil
+}
+
+var (
+	scannerType = reflect.TypeFor[sql.Scanner]()
+	timeType    = reflect.TypeFor[time.Time]()
+)
+
+// isMapped returns true if the columns are mapped to the fields of the type.
+func isMapped(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(scannerType)
+}
+
+// fieldPaths caches the index paths of the fields of the struct types, by column name.
+var fieldPaths sync.Map
+
+// columnPaths returns the index paths of the fields receiving the columns.
+func columnPaths(t reflect.Type, columns []string) ([][]int, error) {
+	fields, ok := fieldPaths.Load(t)
+	if !ok {
+		fields, _ = fieldPaths.LoadOrStore(t, structFields(t))
+	}
+	byName := fields.(map[string][]int)
+
+	paths := make([][]int, len(columns))
+	for i, c := range columns {
+		path, ok := byName[strings.ToLower(c)]
+		if !ok {
+			return nil, fmt.Errorf("txctx: no field of %s for column %q", t, c)
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// structFields returns the index paths of the fields of the struct by column name. The fields
+// of the struct shadow the fields of its embedded structs.
+func structFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	var embedded [][]int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+		if tag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && isMapped(ft) {
+			// Pointers to unexported structs cannot be allocated.
+			if f.IsExported() || f.Type.Kind() != reflect.Pointer {
+				embedded = append(embedded, []int{i})
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := fields[strings.ToLower(name)]; !ok {
+			fields[strings.ToLower(name)] = []int{i}
+		}
+	}
+	for _, index := range embedded {
+		ft := t.Field(index[0]).Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		for name, path := range structFields(ft) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = append(append([]int(nil), index...), path...)
+			}
+		}
+	}
+	return fields
+}
+
+// destinations returns pointers to the fields of the struct at the given paths, allocating the
+// embedded pointers on the way.
+func destinations(v reflect.Value, paths [][]int) []any {
+	dest := make([]any, len(paths))
+	for i, path := range paths {
+		f := v
+		for _, index := range path {
+			if f.Kind() == reflect.Pointer {
+				if f.IsNil() {
+					f.Set(reflect.New(f.Type().Elem()))
+				}
+				f = f.Elem()
+			}
+			f = f.Field(index)
+		}
+		dest[i] = f.Addr().Interface()
+	}
+	return dest
+}
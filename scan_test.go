@@ -0,0 +1,181 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// email is a custom scanner normalizing addresses.
+type email string
+
+func (e *email) Scan(src any) error {
+	s, ok := src.(string)
+	if !ok {
+		return errors.New("email: not a string")
+	}
+	*e = email(strings.ToLower(s))
+	return nil
+}
+
+type audit struct {
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt *time.Time
+}
+
+type Owner struct {
+	OwnerID int `db:"owner_id"`
+}
+
+type account struct {
+	audit
+	*Owner
+	ID       int64
+	Email    email          `db:"email"`
+	Nickname sql.NullString `db:"nickname"`
+	Bio      *string
+	Secret   string `db:"-"`
+}
+
+var accountColumns = []string{"id", "email", "nickname", "bio", "created_at", "updatedat", "owner_id"}
+
+func TestQueryOne(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM accounts").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(accountColumns).AddRow(1, "John@Example.com", nil, "hello", created, nil, 9))
+	mock.ExpectQuery("SELECT (.+) FROM accounts").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(accountColumns).AddRow(2, "jane@example.com", "jj", nil, created, created, 3))
+	mock.ExpectQuery("SELECT (.+) FROM accounts").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(accountColumns))
+
+	bio := "hello"
+	a, err := QueryOne[account](context.Background(), db, "SELECT * FROM accounts WHERE id = ?", 1)
+	require.NoError(t, err)
+	assert.Equal(t, account{
+		audit: audit{CreatedAt: created},
+		Owner: &Owner{OwnerID: 9},
+		ID:    1,
+		Email: "john@example.com",
+		Bio:   &bio,
+	}, a)
+
+	p, err := QueryOne[*account](context.Background(), db, "SELECT * FROM accounts WHERE id = ?", 2)
+	require.NoError(t, err)
+	assert.Equal(t, sql.NullString{String: "jj", Valid: true}, p.Nickname)
+	assert.Nil(t, p.Bio)
+	assert.Equal(t, &created, p.UpdatedAt)
+	assert.Equal(t, 3, p.OwnerID)
+
+	p, err = QueryOne[*account](context.Background(), db, "SELECT * FROM accounts WHERE id = ?", 3)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Nil(t, p)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryOne_UnknownColumn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "secret"}).AddRow(1, "s3cr3t"))
+
+	_, err = QueryOne[account](context.Background(), db, "SELECT id, secret FROM accounts")
+	assert.EqualError(t, err, `txctx: no field of txctx.account for column "secret"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryAll(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, email FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"ID", "Email"}).AddRow(1, "a@example.com").AddRow(2, "b@example.com"))
+	mock.ExpectQuery("SELECT email FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("A@example.com").AddRow("B@example.com"))
+	mock.ExpectQuery("SELECT id FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		p := session.QueryPerformer(ctx)
+
+		accounts, err := QueryAll[account](ctx, p, "SELECT id, email FROM accounts")
+		require.NoError(t, err)
+		require.Len(t, accounts, 2)
+		assert.Equal(t, int64(2), accounts[1].ID)
+		assert.Nil(t, accounts[1].Owner)
+
+		emails, err := QueryAll[email](ctx, p, "SELECT email FROM accounts")
+		require.NoError(t, err)
+		assert.Equal(t, []email{"a@example.com", "b@example.com"}, emails)
+
+		ids, err := QueryAll[int64](ctx, p, "SELECT id FROM accounts WHERE id < 0")
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryScalar(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectQuery("SELECT MAX").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("SELECT name").WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	n, err := QueryScalar[int](context.Background(), db, "SELECT COUNT(*) FROM accounts")
+	require.NoError(t, err)
+	assert.Equal(t, 42, n)
+
+	last, err := QueryScalar[*time.Time](context.Background(), db, "SELECT MAX(created_at) FROM accounts")
+	require.NoError(t, err)
+	assert.Nil(t, last)
+
+	_, err = QueryScalar[string](context.Background(), db, "SELECT name FROM accounts WHERE id = 0")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecReturning(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("INSERT INTO accounts").
+		WithArgs("john@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, created))
+	mock.ExpectQuery("UPDATE accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	a, err := ExecReturning[account](context.Background(), db, "INSERT INTO accounts (email) VALUES (?) RETURNING id, created_at", "john@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), a.ID)
+	assert.Equal(t, created, a.CreatedAt)
+
+	_, err = ExecReturning[int64](context.Background(), db, "UPDATE accounts SET email = '' WHERE id = 0 RETURNING id")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
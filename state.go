@@ -0,0 +1,161 @@
+package txctx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hamidghavidel/txctx/dberr"
+)
+
+var (
+	// ErrNoTransaction is returned when committing a session that holds no transaction,
+	// such as a root session.
+	ErrNoTransaction = errors.New("txctx: no transaction in session")
+
+	// ErrAlreadyCommitted is returned when committing or using a transaction that was already committed.
+	ErrAlreadyCommitted = errors.New("txctx: transaction already committed")
+
+	// ErrAlreadyRolledBack is returned when committing or using a transaction that was already rolled back.
+	ErrAlreadyRolledBack = errors.New("txctx: transaction already rolled back")
+
+	// ErrTransactionFailed is returned when committing or using a transaction whose commit or
+	// rollback failed, see `StateFailed`.
+	ErrTransactionFailed = errors.New("txctx: transaction failed")
+)
+
+// StatefulSession is implemented by the sessions exposing the state of their transaction,
+// such as SQLSession.
+type StatefulSession interface {
+	Session
+
+	// State returns the state of the session.
+	State() State
+
+	// IsActive returns true if the session holds a transaction in progress.
+	IsActive() bool
+}
+
+// State of a session.
+type State int
+
+const (
+	// StateRoot is the state of a root session, which holds no transaction.
+	StateRoot State = iota
+	// StateActive is the state of a child session whose transaction is in progress.
+	StateActive
+	// StateCommitted is the state of a child session whose transaction was committed.
+	StateCommitted
+	// StateRolledBack is the state of a child session whose transaction was rolled back.
+	StateRolledBack
+	// StateFailed is the state of a child session whose commit or rollback failed.
+	// The outcome of the transaction is unknown.
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRoot:
+		return "root"
+	case StateActive:
+		return "active"
+	case StateCommitted:
+		return "committed"
+	case StateRolledBack:
+		return "rolled back"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// stateError returns the error of a misuse of a transaction that is no longer active.
+func stateError(s State) error {
+	switch s {
+	case StateCommitted:
+		return ErrAlreadyCommitted
+	case StateRolledBack:
+		return ErrAlreadyRolledBack
+	}
+	return ErrTransactionFailed
+}
+
+func (t *transaction) currentState() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// commit commits the transaction if it is active, after calling the functions registered
+// with `BeforeCommit()`. Failures are returned as a *TxError, misuses as one of the sentinel errors.
+func (t *transaction) commit() error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+	err := t.commitTx()
+	t.finish()
+	return err
+}
+
+func (t *transaction) commitTx() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state != StateActive {
+		return stateError(t.state)
+	}
+	if t.leaks != nil {
+		if leaks := t.leaks.openRows(t); len(leaks) > 0 {
+			return t.error(PhaseCommit, openRowsError(leaks), nil)
+		}
+	}
+
+	defer t.end()
+	if !t.detach() {
+		// The context was canceled: the transaction is being rolled back by database/sql.
+		t.state = StateRolledBack
+		_ = t.tx.Rollback()
+		return t.error(PhaseCommit, t.ctx.Err(), nil)
+	}
+	if err := t.tx.Commit(); err != nil {
+		t.state = StateFailed
+		if dberr.IsConnectionLost(err) {
+			err = fmt.Errorf("%w: %w", ErrCommitOutcomeUnknown, err)
+		}
+		return t.error(PhaseCommit, err, nil)
+	}
+	t.state = StateCommitted
+	return nil
+}
+
+// rollback rolls the transaction back if it is active. Rolling back a transaction
+// that is already done is a no-op.
+func (t *transaction) rollback() error {
+	err := t.rollbackTx()
+	t.finish()
+	return err
+}
+
+func (t *transaction) rollbackTx() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state != StateActive {
+		return nil
+	}
+	if t.leaks != nil {
+		for _, l := range t.leaks.openRows(t) {
+			t.leaks.onLeak(l)
+		}
+	}
+
+	defer t.end()
+	err := t.tx.Rollback()
+	// The transaction is rolled back by database/sql when its context is canceled.
+	if err != nil && !errors.Is(err, sql.ErrTxDone) {
+		t.state = StateFailed
+		return err
+	}
+	t.state = StateRolledBack
+	return nil
+}
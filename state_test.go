@@ -0,0 +1,144 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLSession_State_Root(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	assert.Equal(t, StateRoot, session.State())
+	assert.False(t, session.IsActive())
+}
+
+func TestSQLSession_State_Commit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, StateActive, child.(StatefulSession).State())
+	assert.True(t, child.(StatefulSession).IsActive())
+
+	require.NoError(t, child.Commit())
+	assert.Equal(t, StateCommitted, child.(StatefulSession).State())
+	assert.False(t, child.(StatefulSession).IsActive())
+
+	assert.ErrorIs(t, child.Commit(), ErrAlreadyCommitted)
+
+	// Deferred rollback after commit is a no-op
+	assert.NoError(t, child.Rollback())
+	assert.Equal(t, StateCommitted, child.(StatefulSession).State())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_State_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, child.Rollback())
+	assert.Equal(t, StateRolledBack, child.(StatefulSession).State())
+
+	assert.NoError(t, child.Rollback())
+	assert.ErrorIs(t, child.Commit(), ErrAlreadyRolledBack)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_State_CommitFailed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	commitErr := errors.New("connection reset")
+
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(commitErr)
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, child.Commit(), commitErr)
+	assert.Equal(t, StateFailed, child.(StatefulSession).State())
+	assert.ErrorIs(t, child.Commit(), ErrTransactionFailed)
+	assert.NoError(t, child.Rollback())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_State_RollbackFailed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	rollbackErr := errors.New("connection reset")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback().WillReturnError(rollbackErr)
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, child.Rollback(), rollbackErr)
+	assert.Equal(t, StateFailed, child.(StatefulSession).State())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLSession_State_ContextCanceled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	child, err := session.Begin(ctx)
+	require.NoError(t, err)
+
+	cancel()
+	assert.NoError(t, child.Rollback())
+	assert.Equal(t, StateRolledBack, child.(StatefulSession).State())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestState_String(t *testing.T) {
+	assert.Equal(t, "root", StateRoot.String())
+	assert.Equal(t, "active", StateActive.String())
+	assert.Equal(t, "committed", StateCommitted.String())
+	assert.Equal(t, "rolled back", StateRolledBack.String())
+	assert.Equal(t, "failed", StateFailed.String())
+	assert.Equal(t, "unknown", State(-1).String())
+}
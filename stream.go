@@ -0,0 +1,63 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+)
+
+// Stream runs the query with the performer and iterates over its rows, scanned into Ts like
+// in `QueryOne()`, without loading them all in memory. The query runs when the iteration starts.
+//
+// The rows are closed when the iteration completes or stops early. An error, from the query,
+// a scan or `sql.Rows.Err()`, is yielded once with the zero T and ends the iteration:
+//
+//	for user, err := range txctx.Stream[User](ctx, p, "SELECT * FROM users") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The performer can be the one of a transaction or of the root session, so the rows are read
+// in the transaction of the context if any.
+func Stream[T any](ctx context.Context, p Performer, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		rows, err := p.QueryContext(ctx, query, args...)
+		if err != nil {
+			var zero T
+			yield(zero, err)
+			return
+		}
+		ScanRows[T](rows)(yield)
+	}
+}
+
+// ScanRows iterates over the rows, scanned into Ts like in `QueryOne()`, and closes them when
+// the iteration completes or stops early. Errors are yielded like in `Stream()`.
+// The rows can only be iterated over once.
+func ScanRows[T any](rows *sql.Rows) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer rows.Close()
+
+		var zero T
+		scan, err := rowScanner[T](rows)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for rows.Next() {
+			v, err := scan()
+			if !yield(v, err) || err != nil {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+			return
+		}
+		if err := rows.Close(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package txctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectQuery("SELECT id, email FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "a@example.com").AddRow(2, "b@example.com")).
+		RowsWillBeClosed()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3)).
+		RowsWillBeClosed()
+	mock.ExpectCommit()
+
+	var accounts []account
+	for a, err := range Stream[account](context.Background(), session.QueryPerformer(context.Background()), "SELECT id, email FROM accounts") {
+		require.NoError(t, err)
+		accounts = append(accounts, a)
+	}
+	require.Len(t, accounts, 2)
+	assert.Equal(t, email("b@example.com"), accounts[1].Email)
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		var ids []int64
+		for id, err := range Stream[int64](ctx, session.QueryPerformer(ctx), "SELECT id FROM accounts") {
+			if err != nil {
+				return err
+			}
+			if ids = append(ids, id); len(ids) == 2 {
+				break
+			}
+		}
+		assert.Equal(t, []int64{1, 2}, ids)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStream_Errors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	queryErr := errors.New("relation does not exist")
+	rowErr := errors.New("connection reset")
+
+	mock.ExpectQuery("SELECT id FROM missing").WillReturnError(queryErr)
+	mock.ExpectQuery("SELECT id FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).RowError(1, rowErr)).
+		RowsWillBeClosed()
+	mock.ExpectQuery("SELECT id, secret FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "secret"}).AddRow(1, "s3cr3t")).
+		RowsWillBeClosed()
+
+	collect := func(query string) ([]int64, []error) {
+		var ids []int64
+		var errs []error
+		for id, err := range Stream[int64](context.Background(), db, query) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		return ids, errs
+	}
+
+	ids, errs := collect("SELECT id FROM missing")
+	assert.Empty(t, ids)
+	assert.Equal(t, []error{queryErr}, errs)
+
+	ids, errs = collect("SELECT id FROM accounts")
+	assert.Equal(t, []int64{1}, ids)
+	assert.Equal(t, []error{rowErr}, errs)
+
+	var n int
+	for _, err := range Stream[account](context.Background(), db, "SELECT id, secret FROM accounts") {
+		assert.EqualError(t, err, `txctx: no field of txctx.account for column "secret"`)
+		n++
+	}
+	assert.Equal(t, 1, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestScanRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT email FROM accounts").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("A@example.com").AddRow(nil)).
+		RowsWillBeClosed()
+
+	rows, err := db.Query("SELECT email FROM accounts")
+	require.NoError(t, err)
+
+	var emails []email
+	var scanErr error
+	for e, err := range ScanRows[email](rows) {
+		if err != nil {
+			scanErr = err
+			continue
+		}
+		emails = append(emails, e)
+	}
+	assert.Equal(t, []email{"a@example.com"}, emails)
+	assert.ErrorContains(t, scanErr, "email: not a string")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
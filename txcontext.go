@@ -0,0 +1,78 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TxContext is a context holding a transaction in progress. It can only be created by `Transact()`
+// and `BeginTxContext()`, so that functions that must run in a transaction can require it in
+// their signature, and the compiler rejects calls with a plain context.
+//
+// It is also a regular context holding the transaction as a value, usable with every function
+// taking a context.
+type TxContext interface {
+	context.Context
+
+	// Tx returns the SQL transaction.
+	Tx() *sql.Tx
+
+	// Performer returns the performer of the transaction, like `Session.QueryPerformer()`.
+	Performer() Performer
+
+	// txn prevents implementations outside of this package.
+	txn() *transaction
+}
+
+type txContext struct {
+	context.Context
+	t *transaction
+}
+
+func (c txContext) Tx() *sql.Tx {
+	return c.t.tx
+}
+
+func (c txContext) Performer() Performer {
+	return c.t.performer()
+}
+
+func (c txContext) txn() *transaction {
+	return c.t
+}
+
+// Transact executes a transaction with the session, like `Session.Transaction()`, handing the
+// function a TxContext. The session must store its transactions in the context like `SQLSession`
+// does, otherwise `ErrNoTransaction` is returned.
+func Transact(ctx context.Context, s Session, f func(ctx TxContext) error) error {
+	return s.Transaction(ctx, func(ctx context.Context) error {
+		tc, err := newTxContext(ctx)
+		if err != nil {
+			return err
+		}
+		return f(tc)
+	})
+}
+
+// BeginTxContext starts a transaction with the session, like `Session.Begin()`, and returns
+// its TxContext along with the child session controlling it.
+func BeginTxContext(ctx context.Context, s Session) (Session, TxContext, error) {
+	child, err := s.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tc, err := newTxContext(child.Context())
+	if err != nil {
+		_ = child.Rollback()
+		return nil, nil, err
+	}
+	return child, tc, nil
+}
+
+func newTxContext(ctx context.Context) (TxContext, error) {
+	t, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return txContext{Context: ctx, t: t}, nil
+}
@@ -0,0 +1,71 @@
+package txctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rename only accepts a context holding a transaction.
+func rename(ctx TxContext, name string) error {
+	_, err := ctx.Performer().ExecContext(ctx, "UPDATE users SET name = ?", name)
+	return err
+}
+
+func TestTransact(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WithArgs("john").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = Transact(context.Background(), session, func(ctx TxContext) error {
+		tx, ok := FromContext(ctx)
+		assert.True(t, ok)
+		assert.Same(t, tx, ctx.Tx())
+		assert.True(t, IsInTransaction(ctx))
+		return rename(ctx, "john")
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransact_Rollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = Transact(context.Background(), SQL(db, nil), func(ctx TxContext) error {
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBeginTxContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WithArgs("john").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	child, ctx, err := BeginTxContext(context.Background(), SQL(db, nil))
+	require.NoError(t, err)
+	defer child.Rollback()
+
+	require.NoError(t, rename(ctx, "john"))
+	require.NoError(t, child.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
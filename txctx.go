@@ -3,6 +3,9 @@ package txctx
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,55 +52,216 @@ type Session interface {
 
 type txKey struct{}
 
+// serials numbers the transactions started in the process.
+var serials atomic.Uint64
+
+type transactionKey struct{}
+
+type nameKey struct{}
+
+// WithName returns a copy of the context naming the transactions started with it.
+// The name is reported in errors and by the watchdog.
+func WithName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nameKey{}, name)
+}
+
+// transaction holds the bookkeeping of a started transaction. It is shared by every
+// copy of the child session and referenced from the transaction's context.
+type transaction struct {
+	tx      *sql.Tx
+	ctx     context.Context
+	cancel  context.CancelFunc
+	name    string
+	started time.Time
+
+	// parent is the context the transaction was started with.
+	parent context.Context
+	hooks  hooks
+
+	// The *sql.Tx is bound to a context detached from the caller's cancellation once
+	// the commit starts. detach unlinks it, release cancels it.
+	detach  func() bool
+	release context.CancelFunc
+
+	// backendID is the transaction ID assigned by the database, see `WithBackendTxID()`.
+	backendID string
+
+	// dialect of the database, see `WithDialect()`.
+	dialect Dialect
+
+	// serial identifies the transaction in the process, see `TransactionID()`.
+	serial uint64
+	// depth is the number of transactions the transaction is nested in, itself included.
+	depth int
+
+	mu    sync.Mutex
+	state State
+
+	// Watchdog bookkeeping, only set when the session has a watchdog.
+	watchdog     *Watchdog
+	id           uint64
+	stack        string
+	lastActivity atomic.Int64
+	warned       bool
+	idle         bool
+
+	// Leak detector bookkeeping, only set when the session has a leak detector.
+	leaks  *LeakDetector
+	leakID uint64
+}
+
+// touch records statement activity on the transaction.
+func (t *transaction) touch() {
+	if t.watchdog != nil {
+		t.lastActivity.Store(t.watchdog.now().UnixNano())
+	}
+}
+
+// end releases the resources held by the transaction once it is committed or rolled back.
+func (t *transaction) end() {
+	if t.watchdog != nil {
+		t.watchdog.untrack(t)
+	}
+	if t.leaks != nil {
+		t.leaks.release(t)
+	}
+	t.cancel()
+	t.release()
+}
+
 // SQLSession is a session implementation using *sql.DB and *sql.Tx.
+// It implements StatefulSession.
 type SQLSession struct {
 	db        *sql.DB
 	tx        *sql.Tx
+	txn       *transaction
 	ctx       context.Context
 	txOptions *sql.TxOptions
+	watchdog  *Watchdog
+	leaks     *LeakDetector
+	dialect   Dialect
+	retry     RetryPolicy
+
+	backendTxID string
 }
 
+// Option configures optional features of a root session.
+type Option func(*SQLSession)
+
 // SQL creates a new root session for *sql.DB.
 // The transaction options are optional.
-func SQL(db *sql.DB, opt *sql.TxOptions) SQLSession {
-	return SQLSession{
+func SQL(db *sql.DB, opt *sql.TxOptions, options ...Option) SQLSession {
+	s := SQLSession{
 		db:        db,
 		txOptions: opt,
 		ctx:       context.Background(),
 	}
+	for _, o := range options {
+		o(&s)
+	}
+	return s
 }
 
 // Begin returns a new session with the given context and a started DB transaction.
 // The returned session has manual controls. Make sure a call to `Rollback()` or `Commit()`
 // is executed before the session is expired (eligible for garbage collection).
 // The SQL transaction associated with this session is injected as a value into the new session's context.
+//
+// If the transaction cannot be started, a *TxError is returned.
 func (s SQLSession) Begin(ctx context.Context) (Session, error) {
-	tx, err := s.db.BeginTx(ctx, s.txOptions)
+	child, err := s.begin(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return SQLSession{
-		db:        s.db,
-		tx:        tx,
-		txOptions: s.txOptions,
-		ctx:       context.WithValue(ctx, txKey{}, tx),
-	}, nil
+	return child, nil
+}
+
+// begin starts a DB transaction and returns the child session holding it.
+func (s SQLSession) begin(ctx context.Context) (SQLSession, error) {
+	t := &transaction{state: StateActive, started: time.Now(), parent: ctx, dialect: s.dialect}
+	t.serial = serials.Add(1)
+	t.depth = NestingDepth(ctx) + 1
+	t.name, _ = ctx.Value(nameKey{}).(string)
+
+	// The transaction's context is canceled with the caller's context, but the *sql.Tx
+	// is bound to a detached context so that a cancellation cannot interrupt the commit.
+	t.ctx, t.cancel = context.WithCancel(ctx)
+	txCtx, release := context.WithCancel(context.WithoutCancel(t.ctx))
+	t.detach = context.AfterFunc(t.ctx, release)
+	t.release = release
+
+	tx, err := s.db.BeginTx(txCtx, s.txOptions)
+	if err != nil {
+		t.cancel()
+		t.release()
+		return SQLSession{}, t.error(PhaseBegin, err, nil)
+	}
+	t.tx = tx
+	if s.backendTxID != "" {
+		if err := tx.QueryRowContext(t.ctx, s.backendTxID).Scan(&t.backendID); err != nil {
+			rollbackErr := tx.Rollback()
+			t.cancel()
+			t.release()
+			return SQLSession{}, t.error(PhaseBegin, err, rollbackErr)
+		}
+	}
+	if s.watchdog != nil {
+		s.watchdog.track(t)
+	}
+	if s.leaks != nil {
+		s.leaks.trackSession(t)
+	}
+
+	t.ctx = context.WithValue(context.WithValue(t.ctx, txKey{}, tx), transactionKey{}, t)
+
+	child := s
+	child.tx = tx
+	child.txn = t
+	child.ctx = t.ctx
+	return child, nil
 }
 
 // Rollback the changes in the transaction. This action is final.
+// Rolling back a root session or a transaction that is already done is a no-op,
+// so `Rollback()` can safely be deferred after `Begin()`.
+//
+// If the rollback fails, a *TxError is returned.
 func (s SQLSession) Rollback() error {
-	if s.tx != nil {
-		return s.tx.Rollback()
+	if s.txn == nil {
+		return nil
+	}
+	if err := s.txn.rollback(); err != nil {
+		return s.txn.error(PhaseRollback, err, nil)
 	}
 	return nil
 }
 
 // Commit the changes in the transaction. This action is final.
+// Committing a root session returns `ErrNoTransaction`, and committing a transaction
+// that is already done returns `ErrAlreadyCommitted` or `ErrAlreadyRolledBack`.
+//
+// If the commit fails, a *TxError is returned.
+//
+// With a leak detector, committing while rows opened in the transaction are still open
+// fails with `ErrOpenRows` and leaves the transaction untouched.
 func (s SQLSession) Commit() error {
-	if s.tx != nil {
-		return s.tx.Commit()
+	if s.txn != nil {
+		return s.txn.commit()
 	}
-	return nil
+	return ErrNoTransaction
+}
+
+// State returns the state of the session.
+func (s SQLSession) State() State {
+	if s.txn != nil {
+		return s.txn.currentState()
+	}
+	return StateRoot
+}
+
+// IsActive returns true if the session holds a transaction in progress.
+func (s SQLSession) IsActive() bool {
+	return s.State() == StateActive
 }
 
 // Context returns the session's context. If it's the root session, `context.Background()`
@@ -111,27 +275,64 @@ func (s SQLSession) Context() context.Context {
 // is rolled back. Otherwise, it is automatically committed before `Transaction()` returns.
 //
 // The SQL transaction associated with this session is injected into the context as a value.
+//
+// Failures are returned as a *TxError recording the phase in which the transaction failed.
+// The error returned by the function can still be matched with `errors.Is()` and `errors.As()`.
+//
+// If the function panics, the transaction is rolled back before the panic propagates.
+//
+// With a retry policy, see `WithRetryPolicy()`, the whole transaction is run again when it fails
+// and the policy allows it.
 func (s SQLSession) Transaction(ctx context.Context, f func(context.Context) error) error {
-	tx, err := s.db.BeginTx(ctx, s.txOptions)
-	if err != nil {
-		return err
+	if s.retry != nil {
+		return s.retryTransaction(ctx, f)
 	}
-	c := context.WithValue(ctx, txKey{}, tx)
-	err = f(c)
+	return s.transaction(ctx, f)
+}
+
+func (s SQLSession) transaction(ctx context.Context, f func(context.Context) error) error {
+	child, err := s.begin(ctx)
 	if err != nil {
-		_ = tx.Rollback()
 		return err
 	}
-	return tx.Commit()
+	t := child.txn
+	defer func() {
+		if p := recover(); p != nil {
+			_ = t.rollback()
+			panic(p)
+		}
+	}()
+	if err = f(child.ctx); err != nil {
+		return t.error(PhaseBody, err, t.rollback())
+	}
+	if err = t.commit(); errors.Is(err, ErrOpenRows) {
+		err.(*TxError).RollbackErr = t.rollback()
+	}
+	return err
 }
 
 // QueryPerformer retrieves the SQL transaction from the context or SQL db.
+//
+// When the session has a watchdog, the transaction is wrapped so that every statement
+// refreshes its idle timer. When it has a leak detector, the rows and statements created
+// by the performer are tracked.
 func (s SQLSession) QueryPerformer(ctx context.Context) Performer {
-	tx := ctx.Value(txKey{})
-	if tx == nil {
-		return s.db
+	var p Performer = s.db
+	if tx := ctx.Value(txKey{}); tx != nil {
+		p = tx.(*sql.Tx)
+	}
+	t, _ := ctx.Value(transactionKey{}).(*transaction)
+	if t != nil && t.watchdog != nil {
+		p = activityPerformer{Performer: p, txn: t}
+	}
+	if s.leaks != nil {
+		lp := leakPerformer{Performer: p, leaks: s.leaks}
+		if t != nil {
+			lp.owner = t.leakID
+		}
+		p = lp
 	}
-	return tx.(*sql.Tx)
+	return p
 }
 
 func (s SQLSession) Failed() bool {
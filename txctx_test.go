@@ -68,7 +68,7 @@ func TestSQLSession_Begin_Error(t *testing.T) {
 	childSession, err := session.Begin(ctx)
 	assert.Error(t, err)
 	assert.Nil(t, childSession)
-	assert.Equal(t, expectedErr, err)
+	assert.ErrorIs(t, err, expectedErr)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -127,7 +127,7 @@ func TestSQLSession_Transaction_Rollback(t *testing.T) {
 	})
 
 	assert.Error(t, err)
-	assert.Equal(t, expectedErr, err)
+	assert.ErrorIs(t, err, expectedErr)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -147,7 +147,7 @@ func TestSQLSession_Transaction_BeginError(t *testing.T) {
 	})
 
 	assert.Error(t, err)
-	assert.Equal(t, expectedErr, err)
+	assert.ErrorIs(t, err, expectedErr)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -312,9 +312,9 @@ func TestSQLSession_CommitWithoutTransaction(t *testing.T) {
 
 	session := SQL(db, nil)
 
-	// Should not panic or error when no transaction is active
+	// Should not panic but report the misuse when no transaction is active
 	err = session.Commit()
-	assert.NoError(t, err)
+	assert.ErrorIs(t, err, ErrNoTransaction)
 }
 
 func TestSQLSession_Failed(t *testing.T) {
@@ -542,7 +542,7 @@ func TestSQLSession_ContextCancellation(t *testing.T) {
 	})
 
 	assert.Error(t, err)
-	assert.Equal(t, context.Canceled, err)
+	assert.ErrorIs(t, err, context.Canceled)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
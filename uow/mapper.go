@@ -0,0 +1,136 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	// ErrNoMapper is returned when registering an aggregate whose type has no mapper.
+	ErrNoMapper = errors.New("uow: no mapper for type")
+
+	// ErrDependencyCycle is returned when flushing aggregates whose dependencies form a cycle.
+	ErrDependencyCycle = errors.New("uow: dependency cycle")
+)
+
+// Mapper writes the aggregates of type T. Its methods receive the transaction's context,
+// in which they can execute statements through `QueryPerformer()`.
+type Mapper[T any] interface {
+	// ID returns the identity of the aggregate, used by the identity map. It must be comparable.
+	ID(v T) any
+	Insert(ctx context.Context, v T) error
+	Update(ctx context.Context, v T) error
+	Delete(ctx context.Context, v T) error
+}
+
+// Dependency declares that the aggregates of a type depend on the aggregates of another type.
+type Dependency struct {
+	typ reflect.Type
+}
+
+// After returns a dependency on the aggregates of type T: they are inserted and updated
+// before the dependent aggregates, and deleted after them.
+func After[T any]() Dependency {
+	return Dependency{typ: reflect.TypeFor[T]()}
+}
+
+// mapping is the type-erased mapper of an aggregate type.
+type mapping struct {
+	typ    reflect.Type
+	deps   []reflect.Type
+	id     func(any) any
+	insert func(context.Context, any) error
+	update func(context.Context, any) error
+	delete func(context.Context, any) error
+}
+
+// Registry holds the mappers of the aggregate types. It is typically created once and shared.
+type Registry struct {
+	mu       sync.RWMutex
+	mappings map[reflect.Type]*mapping
+	// types in registration order.
+	types []reflect.Type
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{mappings: make(map[reflect.Type]*mapping)}
+}
+
+// Register the mapper of the aggregates of type T, replacing the previous one.
+// T is usually a pointer type, such as *Order.
+func Register[T any](r *Registry, m Mapper[T], deps ...Dependency) {
+	mp := &mapping{
+		typ:    reflect.TypeFor[T](),
+		id:     func(v any) any { return m.ID(v.(T)) },
+		insert: func(ctx context.Context, v any) error { return m.Insert(ctx, v.(T)) },
+		update: func(ctx context.Context, v any) error { return m.Update(ctx, v.(T)) },
+		delete: func(ctx context.Context, v any) error { return m.Delete(ctx, v.(T)) },
+	}
+	for _, d := range deps {
+		mp.deps = append(mp.deps, d.typ)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.mappings[mp.typ]; !ok {
+		r.types = append(r.types, mp.typ)
+	}
+	r.mappings[mp.typ] = mp
+}
+
+func (r *Registry) mapping(v any) (*mapping, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.mappings[reflect.TypeOf(v)]
+	if !ok {
+		return nil, fmt.Errorf("%w %T", ErrNoMapper, v)
+	}
+	return m, nil
+}
+
+// order returns the registered types sorted so that every type comes after its dependencies.
+// Types without dependencies between them keep their registration order.
+func (r *Registry) order() ([]reflect.Type, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	marks := make(map[reflect.Type]int, len(r.types))
+	sorted := make([]reflect.Type, 0, len(r.types))
+	var visit func(t reflect.Type) error
+	visit = func(t reflect.Type) error {
+		switch marks[t] {
+		case visiting:
+			return fmt.Errorf("%w involving %s", ErrDependencyCycle, t)
+		case visited:
+			return nil
+		}
+		m, ok := r.mappings[t]
+		if !ok {
+			// Dependency on a type without mapper: nothing to order.
+			return nil
+		}
+		marks[t] = visiting
+		for _, d := range m.deps {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		marks[t] = visited
+		sorted = append(sorted, t)
+		return nil
+	}
+	for _, t := range r.types {
+		if err := visit(t); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,84 @@
+package uow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+type customer struct {
+	ID   int
+	Name string
+}
+
+type order struct {
+	ID         int
+	CustomerID int
+	Total      int
+}
+
+type line struct {
+	ID      int
+	OrderID int
+}
+
+// tableMapper writes aggregates to a table through the session.
+type tableMapper[T any] struct {
+	session txctx.Session
+	table   string
+	id      func(T) any
+}
+
+func (m tableMapper[T]) ID(v T) any { return m.id(v) }
+
+func (m tableMapper[T]) Insert(ctx context.Context, v T) error {
+	_, err := m.session.QueryPerformer(ctx).ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id) VALUES (?)", m.table), m.id(v))
+	return err
+}
+
+func (m tableMapper[T]) Update(ctx context.Context, v T) error {
+	_, err := m.session.QueryPerformer(ctx).ExecContext(ctx, fmt.Sprintf("UPDATE %s SET data = ? WHERE id = ?", m.table), fmt.Sprint(v), m.id(v))
+	return err
+}
+
+func (m tableMapper[T]) Delete(ctx context.Context, v T) error {
+	_, err := m.session.QueryPerformer(ctx).ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", m.table), m.id(v))
+	return err
+}
+
+func TestRegistry_Order(t *testing.T) {
+	r := NewRegistry()
+	Register[*line](r, tableMapper[*line]{}, After[*order]())
+	Register[*order](r, tableMapper[*order]{}, After[*customer]())
+	Register[*customer](r, tableMapper[*customer]{})
+
+	sorted, err := r.order()
+	require.NoError(t, err)
+	assert.Equal(t, []reflect.Type{
+		reflect.TypeFor[*customer](),
+		reflect.TypeFor[*order](),
+		reflect.TypeFor[*line](),
+	}, sorted)
+}
+
+func TestRegistry_Cycle(t *testing.T) {
+	r := NewRegistry()
+	Register[*order](r, tableMapper[*order]{}, After[*customer]())
+	Register[*customer](r, tableMapper[*customer]{}, After[*order]())
+
+	_, err := r.order()
+	assert.ErrorIs(t, err, ErrDependencyCycle)
+}
+
+func TestRegistry_NoMapper(t *testing.T) {
+	r := NewRegistry()
+
+	_, err := r.mapping(&customer{})
+	assert.ErrorIs(t, err, ErrNoMapper)
+}
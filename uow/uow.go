@@ -0,0 +1,334 @@
+// Package uow implements the Unit of Work pattern on top of the transaction in the context.
+//
+// During a use case, new, modified and deleted aggregates are registered with the unit of
+// work of the transaction instead of being written inline. They are written in one go when
+// the transaction commits, in an order following the dependencies between aggregate types,
+// and discarded when it is rolled back.
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+var (
+	// ErrAlreadyRegistered is returned when registering as new an aggregate that is already tracked.
+	ErrAlreadyRegistered = errors.New("uow: aggregate already registered")
+
+	// ErrDeleted is returned when registering as dirty an aggregate registered as deleted.
+	ErrDeleted = errors.New("uow: aggregate registered as deleted")
+)
+
+type status int
+
+const (
+	clean status = iota
+	added
+	dirty
+	removed
+)
+
+type entry struct {
+	m      *mapping
+	v      any
+	status status
+	// snapshot is a shallow copy of the aggregate pointed to, taken when it was last known
+	// to match the database. It is nil for aggregates that are not pointers.
+	snapshot any
+}
+
+// changed returns true if the aggregate must be written.
+func (e *entry) changed() bool {
+	if e.status != clean {
+		return true
+	}
+	return e.snapshot != nil && !reflect.DeepEqual(e.snapshot, reflect.ValueOf(e.v).Elem().Interface())
+}
+
+func (e *entry) takeSnapshot() {
+	rv := reflect.ValueOf(e.v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return
+	}
+	c := reflect.New(rv.Elem().Type()).Elem()
+	c.Set(rv.Elem())
+	e.snapshot = c.Interface()
+}
+
+type identity struct {
+	typ reflect.Type
+	id  any
+}
+
+// UnitOfWork tracks the aggregates loaded and modified during a transaction.
+type UnitOfWork struct {
+	registry *Registry
+
+	mu      sync.Mutex
+	entries []*entry
+	index   map[identity]*entry
+}
+
+type attachKey struct {
+	registry *Registry
+}
+
+// From returns the unit of work of the transaction in the context, creating it on first use.
+// It is flushed when the transaction commits and discarded when it is rolled back. When a
+// savepoint is rolled back, the aggregates are tracked again as they were when it started,
+// and the unit of work remains in use for the rest of the transaction.
+// `txctx.ErrNoTransaction` is returned if the context holds no transaction.
+func From(ctx context.Context, r *Registry) (*UnitOfWork, error) {
+	created := false
+	v, err := txctx.Attach(ctx, attachKey{registry: r}, func() any {
+		created = true
+		return &UnitOfWork{registry: r, index: make(map[identity]*entry)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := v.(*UnitOfWork)
+	if created {
+		if err := txctx.BeforeCommit(txctx.WithoutSavepoint(ctx), w.Flush); err != nil {
+			return nil, err
+		}
+		if err := txctx.OnSavepoint(ctx, w.savepoint); err != nil {
+			return nil, err
+		}
+		// Empties the unit of work if the transaction, or the savepoint it is created in,
+		// is rolled back.
+		w.savepoint(ctx)
+	}
+	return w, nil
+}
+
+// savepoint restores the entries as they are now if the savepoint in the context is rolled back.
+func (w *UnitOfWork) savepoint(ctx context.Context) {
+	w.mu.Lock()
+	ids := make(map[*entry]identity, len(w.index))
+	for id, e := range w.index {
+		ids[e] = id
+	}
+	saved := make([]tracked, len(w.entries))
+	for i, e := range w.entries {
+		saved[i] = tracked{id: ids[e], e: *e}
+	}
+	w.mu.Unlock()
+
+	_ = txctx.AfterRollback(ctx, func(context.Context) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.entries = nil
+		w.index = make(map[identity]*entry, len(saved))
+		for _, t := range saved {
+			e := t.e
+			w.track(&e, t.id)
+		}
+	})
+}
+
+// tracked is a copy of an entry and its identity.
+type tracked struct {
+	id identity
+	e  entry
+}
+
+// RegisterNew registers an aggregate to insert.
+func (w *UnitOfWork) RegisterNew(v any) error {
+	m, id, err := w.identify(v)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.index[id]; ok {
+		return fmt.Errorf("%w: %T %v", ErrAlreadyRegistered, v, id.id)
+	}
+	w.track(&entry{m: m, v: v, status: added}, id)
+	return nil
+}
+
+// RegisterDirty registers an aggregate to update. Aggregates registered as new stay new.
+func (w *UnitOfWork) RegisterDirty(v any) error {
+	m, id, err := w.identify(v)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.index[id]
+	if !ok {
+		w.track(&entry{m: m, v: v, status: dirty}, id)
+		return nil
+	}
+	switch e.status {
+	case removed:
+		return fmt.Errorf("%w: %T %v", ErrDeleted, v, id.id)
+	case clean:
+		e.status = dirty
+	}
+	e.v = v
+	return nil
+}
+
+// RegisterDeleted registers an aggregate to delete. Aggregates registered as new are
+// simply forgotten.
+func (w *UnitOfWork) RegisterDeleted(v any) error {
+	m, id, err := w.identify(v)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.index[id]
+	if !ok {
+		w.track(&entry{m: m, v: v, status: removed}, id)
+		return nil
+	}
+	if e.status == added {
+		w.untrack(e, id)
+		return nil
+	}
+	e.status = removed
+	e.v = v
+	return nil
+}
+
+// RegisterClean registers an aggregate loaded from the database in the identity map.
+// Aggregates that are pointers are compared with a shallow copy taken at registration,
+// and updated at flush if they were modified. Registering an aggregate that is already
+// tracked is a no-op.
+func (w *UnitOfWork) RegisterClean(v any) error {
+	m, id, err := w.identify(v)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.index[id]; ok {
+		return nil
+	}
+	e := &entry{m: m, v: v, status: clean}
+	e.takeSnapshot()
+	w.track(e, id)
+	return nil
+}
+
+// Get returns the aggregate of type T with the given identity from the identity map.
+// Aggregates registered as deleted are not returned.
+func Get[T any](w *UnitOfWork, id any) (T, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.index[identity{typ: reflect.TypeFor[T](), id: id}]
+	if !ok || e.status == removed {
+		var zero T
+		return zero, false
+	}
+	return e.v.(T), true
+}
+
+// Flush writes the pending changes: inserts and updates follow the dependencies between
+// aggregate types, deletes go in reverse order. It is called when the transaction commits,
+// and can be called earlier, for instance to obtain generated values.
+func (w *UnitOfWork) Flush(ctx context.Context) error {
+	order, err := w.registry.order()
+	if err != nil {
+		return err
+	}
+	// Mappers may register more changes while flushing.
+	for {
+		pending := w.pending()
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := w.write(ctx, order, pending); err != nil {
+			return err
+		}
+		w.mu.Lock()
+		for _, e := range pending {
+			if e.status == removed {
+				w.untrack(e, identity{typ: e.m.typ, id: e.m.id(e.v)})
+				continue
+			}
+			e.status = clean
+			e.takeSnapshot()
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (w *UnitOfWork) write(ctx context.Context, order []reflect.Type, pending []*entry) error {
+	byType := make(map[reflect.Type][]*entry)
+	for _, e := range pending {
+		byType[e.m.typ] = append(byType[e.m.typ], e)
+	}
+	for _, t := range order {
+		for _, e := range byType[t] {
+			if e.status == added {
+				if err := e.m.insert(ctx, e.v); err != nil {
+					return fmt.Errorf("uow: cannot insert %T: %w", e.v, err)
+				}
+			}
+		}
+	}
+	for _, t := range order {
+		for _, e := range byType[t] {
+			if e.status == dirty || e.status == clean {
+				if err := e.m.update(ctx, e.v); err != nil {
+					return fmt.Errorf("uow: cannot update %T: %w", e.v, err)
+				}
+			}
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		for _, e := range byType[order[i]] {
+			if e.status == removed {
+				if err := e.m.delete(ctx, e.v); err != nil {
+					return fmt.Errorf("uow: cannot delete %T: %w", e.v, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pending returns the entries to write, in registration order.
+func (w *UnitOfWork) pending() []*entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var pending []*entry
+	for _, e := range w.entries {
+		if e.changed() {
+			pending = append(pending, e)
+		}
+	}
+	return pending
+}
+
+func (w *UnitOfWork) identify(v any) (*mapping, identity, error) {
+	m, err := w.registry.mapping(v)
+	if err != nil {
+		return nil, identity{}, err
+	}
+	return m, identity{typ: m.typ, id: m.id(v)}, nil
+}
+
+func (w *UnitOfWork) track(e *entry, id identity) {
+	w.entries = append(w.entries, e)
+	w.index[id] = e
+}
+
+func (w *UnitOfWork) untrack(e *entry, id identity) {
+	delete(w.index, id)
+	for i, other := range w.entries {
+		if other == e {
+			w.entries = append(w.entries[:i], w.entries[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hamidghavidel/txctx"
+)
+
+func newTestRegistry(t *testing.T) (txctx.Session, *Registry, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	session := txctx.SQL(db, nil)
+	r := NewRegistry()
+	Register[*order](r, tableMapper[*order]{session: session, table: "orders", id: func(o *order) any { return o.ID }}, After[*customer]())
+	Register[*customer](r, tableMapper[*customer]{session: session, table: "customers", id: func(c *customer) any { return c.ID }})
+	return session, r, mock
+}
+
+func TestUnitOfWork_FlushAtCommit(t *testing.T) {
+	session, r, mock := newTestRegistry(t)
+
+	mock.ExpectBegin()
+	// Inserts and updates follow the dependencies, deletes go in reverse order
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO customers (id) VALUES (?)")).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO orders (id) VALUES (?)")).WithArgs(10).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE customers SET data = ? WHERE id = ?")).WithArgs("&{2 Bob}", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM orders WHERE id = ?")).WithArgs(11).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM customers WHERE id = ?")).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		w, err := From(ctx, r)
+		require.NoError(t, err)
+
+		require.NoError(t, w.RegisterDeleted(&customer{ID: 3}))
+		require.NoError(t, w.RegisterNew(&order{ID: 10, CustomerID: 1}))
+		require.NoError(t, w.RegisterNew(&customer{ID: 1, Name: "Alice"}))
+		require.NoError(t, w.RegisterDeleted(&order{ID: 11}))
+
+		// Loaded aggregates are updated only if modified
+		bob := &customer{ID: 2, Name: "Robert"}
+		require.NoError(t, w.RegisterClean(bob))
+		require.NoError(t, w.RegisterClean(&order{ID: 12}))
+		bob.Name = "Bob"
+
+		// New then deleted aggregates are never written
+		require.NoError(t, w.RegisterNew(&order{ID: 13}))
+		require.NoError(t, w.RegisterDeleted(&order{ID: 13}))
+
+		same, err := From(ctx, r)
+		require.NoError(t, err)
+		assert.Same(t, w, same)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_CreatedInSavepointRolledBack(t *testing.T) {
+	session, r, mock := newTestRegistry(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	// The customer registered within the savepoint is discarded with it
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO customers (id) VALUES (?)")).WithArgs(2).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		err := txctx.Savepoint(ctx, func(ctx context.Context) error {
+			w, err := From(ctx, r)
+			require.NoError(t, err)
+			require.NoError(t, w.RegisterNew(&customer{ID: 1, Name: "Alice"}))
+			return errors.New("invalid address")
+		})
+		require.Error(t, err)
+
+		w, err := From(ctx, r)
+		require.NoError(t, err)
+		return w.RegisterNew(&customer{ID: 2, Name: "Bob"})
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_RegisteredInSavepointRolledBack(t *testing.T) {
+	session, r, mock := newTestRegistry(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT txctx_sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	// The aggregates are tracked as they were before the savepoint
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO orders (id) VALUES (?)")).WithArgs(10).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		w, err := From(ctx, r)
+		require.NoError(t, err)
+		require.NoError(t, w.RegisterNew(&order{ID: 10}))
+
+		err = txctx.Savepoint(ctx, func(ctx context.Context) error {
+			require.NoError(t, w.RegisterNew(&order{ID: 11}))
+			require.NoError(t, w.RegisterDeleted(&order{ID: 10}))
+			return errors.New("out of stock")
+		})
+		require.Error(t, err)
+
+		_, ok := Get[*order](w, 11)
+		assert.False(t, ok)
+		_, ok = Get[*order](w, 10)
+		assert.True(t, ok)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_IdentityMap(t *testing.T) {
+	session, r, mock := newTestRegistry(t)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+	w, err := From(child.Context(), r)
+	require.NoError(t, err)
+
+	alice := &customer{ID: 1, Name: "Alice"}
+	require.NoError(t, w.RegisterClean(alice))
+	require.NoError(t, w.RegisterClean(&customer{ID: 1, Name: "Stale"}))
+
+	got, ok := Get[*customer](w, 1)
+	assert.True(t, ok)
+	assert.Same(t, alice, got)
+
+	_, ok = Get[*order](w, 1)
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, w.RegisterNew(&customer{ID: 1}), ErrAlreadyRegistered)
+	require.NoError(t, w.RegisterDeleted(alice))
+	assert.ErrorIs(t, w.RegisterDirty(alice), ErrDeleted)
+	_, ok = Get[*customer](w, 1)
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, w.RegisterNew(&line{ID: 1}), ErrNoMapper)
+
+	// Rolling back discards the changes
+	require.NoError(t, child.Rollback())
+	assert.Empty(t, w.pending())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_FlushError(t *testing.T) {
+	session, r, mock := newTestRegistry(t)
+	insertErr := errors.New("duplicate key")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO customers").WillReturnError(insertErr)
+	mock.ExpectRollback()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		w, err := From(ctx, r)
+		require.NoError(t, err)
+		return w.RegisterNew(&customer{ID: 1})
+	})
+
+	assert.ErrorIs(t, err, insertErr)
+	var txErr *txctx.TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, txctx.PhaseCommit, txErr.Phase)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_ExplicitFlush(t *testing.T) {
+	session, r, mock := newTestRegistry(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO customers").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE customers SET data = ? WHERE id = ?")).WithArgs("&{1 Alice}", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := session.Transaction(context.Background(), func(ctx context.Context) error {
+		w, err := From(ctx, r)
+		require.NoError(t, err)
+
+		c := &customer{ID: 1}
+		require.NoError(t, w.RegisterNew(c))
+		require.NoError(t, w.Flush(ctx))
+
+		// Flushed aggregates are tracked as clean
+		c.Name = "Alice"
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFrom_NoTransaction(t *testing.T) {
+	_, err := From(context.Background(), NewRegistry())
+	assert.ErrorIs(t, err, txctx.ErrNoTransaction)
+}
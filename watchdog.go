@@ -0,0 +1,257 @@
+package txctx
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// WatchdogEventKind identifies the condition reported by a watchdog.
+type WatchdogEventKind int
+
+const (
+	// LongRunning is reported once when a transaction outlives the soft threshold.
+	LongRunning WatchdogEventKind = iota + 1
+	// Idle is reported when no statement was executed in a transaction for too long.
+	// It is reported again if the transaction becomes idle after new activity.
+	Idle
+	// Aborted is reported when a transaction exceeded the hard maximum and was rolled back.
+	Aborted
+)
+
+func (k WatchdogEventKind) String() string {
+	switch k {
+	case LongRunning:
+		return "long-running"
+	case Idle:
+		return "idle"
+	case Aborted:
+		return "aborted"
+	}
+	return "unknown"
+}
+
+// TxInfo describes an open transaction tracked by a watchdog.
+type TxInfo struct {
+	ID uint64
+	// Name of the transaction, set with `WithName()`.
+	Name         string
+	Started      time.Time
+	LastActivity time.Time
+	// Stack is the stack trace of the goroutine that started the transaction.
+	Stack string
+}
+
+// WatchdogEvent is emitted by a watchdog when a transaction crosses one of its thresholds.
+type WatchdogEvent struct {
+	Kind WatchdogEventKind
+	Tx   TxInfo
+	// Age is how long the transaction had been open when the event was emitted.
+	Age time.Duration
+	// IdleFor is the time elapsed since the last statement executed in the transaction.
+	IdleFor time.Duration
+}
+
+// WatchdogConfig configures a watchdog. Zero thresholds are disabled.
+type WatchdogConfig struct {
+	// WarnAfter is the soft threshold after which a LongRunning event is emitted.
+	WarnAfter time.Duration
+
+	// MaxDuration is the hard maximum. Past it, the transaction's context is canceled
+	// and the transaction is rolled back.
+	MaxDuration time.Duration
+
+	// IdleTimeout is the maximum time a transaction may stay idle between statements.
+	// Activity is only tracked for statements run through `QueryPerformer()`.
+	IdleTimeout time.Duration
+
+	// Interval between two checks performed by `Run()`. Defaults to one second.
+	Interval time.Duration
+
+	// OnEvent is called for every event. Defaults to a warning logged with slog.
+	OnEvent func(WatchdogEvent)
+}
+
+// Watchdog keeps track of every transaction opened by the sessions it is attached to
+// with `WithWatchdog()`, and reports the ones that hold their locks for too long.
+//
+// The checks are performed by `Run()` or by calling `Check()` manually.
+type Watchdog struct {
+	cfg WatchdogConfig
+	now func() time.Time
+
+	mu   sync.Mutex
+	seq  uint64
+	open map[uint64]*transaction
+}
+
+// NewWatchdog creates a new watchdog with the given configuration.
+func NewWatchdog(cfg WatchdogConfig) *Watchdog {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.OnEvent == nil {
+		cfg.OnEvent = logWatchdogEvent
+	}
+	return &Watchdog{
+		cfg:  cfg,
+		now:  time.Now,
+		open: make(map[uint64]*transaction),
+	}
+}
+
+// WithWatchdog attaches a watchdog to the session. Every transaction started
+// with `Begin()` or `Transaction()` is tracked until it is committed or rolled back.
+func WithWatchdog(w *Watchdog) Option {
+	return func(s *SQLSession) {
+		s.watchdog = w
+	}
+}
+
+// Run performs the checks periodically until the given context is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// Open returns the transactions currently tracked by the watchdog.
+func (w *Watchdog) Open() []TxInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	infos := make([]TxInfo, 0, len(w.open))
+	for _, t := range w.open {
+		infos = append(infos, t.info())
+	}
+	return infos
+}
+
+// Check inspects the open transactions once, emits the events and aborts the
+// transactions that exceeded the hard maximum.
+func (w *Watchdog) Check() {
+	now := w.now()
+
+	var events []WatchdogEvent
+	var aborted []*transaction
+
+	w.mu.Lock()
+	for id, t := range w.open {
+		evt := WatchdogEvent{
+			Tx:      t.info(),
+			Age:     now.Sub(t.started),
+			IdleFor: now.Sub(time.Unix(0, t.lastActivity.Load())),
+		}
+		if w.cfg.MaxDuration > 0 && evt.Age > w.cfg.MaxDuration {
+			delete(w.open, id)
+			aborted = append(aborted, t)
+			evt.Kind = Aborted
+			events = append(events, evt)
+			continue
+		}
+		if w.cfg.WarnAfter > 0 && evt.Age > w.cfg.WarnAfter && !t.warned {
+			t.warned = true
+			evt.Kind = LongRunning
+			events = append(events, evt)
+		}
+		if w.cfg.IdleTimeout > 0 {
+			switch {
+			case evt.IdleFor <= w.cfg.IdleTimeout:
+				t.idle = false
+			case !t.idle:
+				t.idle = true
+				evt.Kind = Idle
+				events = append(events, evt)
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	for _, t := range aborted {
+		t.cancel()
+		_ = t.rollback()
+	}
+	for _, evt := range events {
+		w.cfg.OnEvent(evt)
+	}
+}
+
+func (w *Watchdog) track(t *transaction) {
+	now := w.now()
+	t.watchdog = w
+	t.started = now
+	t.stack = string(debug.Stack())
+	t.lastActivity.Store(now.UnixNano())
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	t.id = w.seq
+	w.open[t.id] = t
+}
+
+func (w *Watchdog) untrack(t *transaction) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.open, t.id)
+}
+
+func (t *transaction) info() TxInfo {
+	return TxInfo{
+		ID:           t.id,
+		Name:         t.name,
+		Started:      t.started,
+		LastActivity: time.Unix(0, t.lastActivity.Load()),
+		Stack:        t.stack,
+	}
+}
+
+func logWatchdogEvent(evt WatchdogEvent) {
+	slog.Warn("txctx: transaction "+evt.Kind.String(),
+		slog.Uint64("tx", evt.Tx.ID),
+		slog.String("name", evt.Tx.Name),
+		slog.Duration("age", evt.Age),
+		slog.Duration("idle", evt.IdleFor),
+		slog.String("stack", evt.Tx.Stack),
+	)
+}
+
+// activityPerformer refreshes the idle timer of a transaction on every statement.
+type activityPerformer struct {
+	Performer
+	txn *transaction
+}
+
+func (p activityPerformer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	p.txn.touch()
+	defer p.txn.touch()
+	return p.Performer.ExecContext(ctx, query, args...)
+}
+
+func (p activityPerformer) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	p.txn.touch()
+	defer p.txn.touch()
+	return p.Performer.QueryContext(ctx, query, args...)
+}
+
+func (p activityPerformer) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	p.txn.touch()
+	defer p.txn.touch()
+	return p.Performer.QueryRowContext(ctx, query, args...)
+}
+
+func (p activityPerformer) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	p.txn.touch()
+	defer p.txn.touch()
+	return p.Performer.PrepareContext(ctx, query)
+}
@@ -0,0 +1,198 @@
+package txctx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestWatchdog(cfg WatchdogConfig) (*Watchdog, *fakeClock, *[]WatchdogEvent) {
+	var events []WatchdogEvent
+	cfg.OnEvent = func(evt WatchdogEvent) {
+		events = append(events, evt)
+	}
+	w := NewWatchdog(cfg)
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	w.now = clock.now
+	return w, clock, &events
+}
+
+func TestWatchdog_TracksOpenTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	w, _, _ := newTestWatchdog(WatchdogConfig{})
+	session := SQL(db, nil, WithWatchdog(w))
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		open := w.Open()
+		require.Len(t, open, 1)
+		assert.Equal(t, uint64(1), open[0].ID)
+		assert.Contains(t, open[0].Stack, "TestWatchdog_TracksOpenTransactions")
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, w.Open())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWatchdog_LongRunning(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	w, clock, events := newTestWatchdog(WatchdogConfig{WarnAfter: time.Minute})
+	session := SQL(db, nil, WithWatchdog(w))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	clock.advance(30 * time.Second)
+	w.Check()
+	assert.Empty(t, *events)
+
+	clock.advance(time.Minute)
+	w.Check()
+	w.Check()
+	require.Len(t, *events, 1)
+	assert.Equal(t, LongRunning, (*events)[0].Kind)
+	assert.Equal(t, 90*time.Second, (*events)[0].Age)
+
+	assert.NoError(t, child.Rollback())
+	assert.Empty(t, w.Open())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWatchdog_Idle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	w, clock, events := newTestWatchdog(WatchdogConfig{IdleTimeout: 10 * time.Second})
+	session := SQL(db, nil, WithWatchdog(w))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	child, err := session.Begin(context.Background())
+	require.NoError(t, err)
+
+	clock.advance(15 * time.Second)
+	w.Check()
+	require.Len(t, *events, 1)
+	assert.Equal(t, Idle, (*events)[0].Kind)
+	assert.Equal(t, 15*time.Second, (*events)[0].IdleFor)
+
+	// A statement resets the idle timer.
+	ctx := child.Context()
+	_, err = child.QueryPerformer(ctx).ExecContext(ctx, "UPDATE users SET verified = true")
+	require.NoError(t, err)
+
+	clock.advance(5 * time.Second)
+	w.Check()
+	assert.Len(t, *events, 1)
+
+	clock.advance(10 * time.Second)
+	w.Check()
+	require.Len(t, *events, 2)
+	assert.Equal(t, Idle, (*events)[1].Kind)
+
+	assert.NoError(t, child.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWatchdog_AbortsPastMaxDuration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	w, clock, events := newTestWatchdog(WatchdogConfig{WarnAfter: time.Minute, MaxDuration: 5 * time.Minute})
+	session := SQL(db, nil, WithWatchdog(w))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		clock.advance(10 * time.Minute)
+		w.Check()
+
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+		return ctx.Err()
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	require.Len(t, *events, 1)
+	assert.Equal(t, Aborted, (*events)[0].Kind)
+	assert.Empty(t, w.Open())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWatchdog_Run(t *testing.T) {
+	w, _, _ := newTestWatchdog(WatchdogConfig{Interval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after context cancellation")
+	}
+}
+
+func TestWatchdogEventKind_String(t *testing.T) {
+	assert.Equal(t, "long-running", LongRunning.String())
+	assert.Equal(t, "idle", Idle.String())
+	assert.Equal(t, "aborted", Aborted.String())
+	assert.Equal(t, "unknown", WatchdogEventKind(0).String())
+}
+
+func TestSQLSession_QueryPerformer_WithoutWatchdog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	session := SQL(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err = session.Transaction(context.Background(), func(ctx context.Context) error {
+		_, wrapped := session.QueryPerformer(ctx).(activityPerformer)
+		assert.False(t, wrapped)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}